@@ -0,0 +1,254 @@
+package doctor
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/pki"
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+const (
+	StatusPresent   = "present"
+	StatusMissing   = "missing"
+	StatusMalformed = "malformed"
+)
+
+type Config struct {
+	*app.App     `flag:"-"`
+	Output       string        `flag:"output o" desc:"Where the report is written"`
+	Require      []string      `flag:"require r" desc:"Variables that must be present, by accessor name (e.g. Relationships)"`
+	Timeout      time.Duration `flag:"timeout" desc:"How long to wait when dialing each relationship host"`
+	SkipListener bool          `flag:"skip-listener" desc:"Don't check that the listener can bind, e.g. while the server is running"`
+	SkipPKI      bool          `flag:"skip-pki" desc:"Don't check the PKI_* variables"`
+}
+
+type Report struct {
+	OK            bool             `json:"ok"`
+	Variables     []VariableReport `json:"variables"`
+	Listener      *Check           `json:"listener,omitempty"`
+	Relationships []Check          `json:"relationships"`
+	PKI           *Check           `json:"pki,omitempty"`
+}
+
+type VariableReport struct {
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	Status   string `json:"status"`
+	Required bool   `json:"required,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func newCheck(name string, err error) Check {
+	rv := Check{Name: name, OK: err == nil}
+	if err != nil {
+		rv.Error = err.Error()
+	}
+	return rv
+}
+
+func New(app *app.App) app.Config {
+	return &Config{
+		App:     app,
+		Output:  "-",
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (c *Config) Use() string {
+	return "doctor"
+}
+
+func (c *Config) Args(cmd *cobra.Command, args []string) error {
+	return cobra.NoArgs(cmd, args)
+}
+
+func (c *Config) Run(cmd *cobra.Command, args []string) error {
+	report := c.Report()
+
+	fp, err := c.GetOutput(c.Output)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	if !report.OK {
+		// the report is the error message
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return errors.New("environment check failed")
+	}
+	return nil
+}
+
+func (c *Config) Report() Report {
+	env := c.App.Environment
+	rv := Report{OK: true}
+
+	required := make(map[string]bool, len(c.Require))
+	for _, name := range c.Require {
+		if _, ok := platformsh.LookupWellKnownVariable(name); !ok {
+			logrus.WithField("name", name).Warn("unknown required variable")
+			rv.OK = false
+		}
+		required[name] = true
+	}
+
+	for _, v := range platformsh.WellKnownVariables {
+		vr := checkVariable(env, v)
+		vr.Required = required[v.Name]
+		if vr.Status == StatusMalformed || (vr.Status == StatusMissing && vr.Required) {
+			rv.OK = false
+		}
+		rv.Variables = append(rv.Variables, vr)
+	}
+
+	if !c.SkipListener {
+		check := newCheck("listener", checkListener(env))
+		rv.Listener = &check
+		rv.OK = rv.OK && check.OK
+	}
+
+	rv.Relationships = c.checkRelationships(env)
+	for _, check := range rv.Relationships {
+		rv.OK = rv.OK && check.OK
+	}
+
+	if !c.SkipPKI {
+		check := newCheck("pki", checkPKI(env))
+		rv.PKI = &check
+		rv.OK = rv.OK && check.OK
+	}
+
+	return rv
+}
+
+func checkVariable(env platformsh.Environment, v platformsh.WellKnownVariable) VariableReport {
+	rv := VariableReport{
+		Name:   v.Name,
+		Key:    v.Key(env.Prefix()),
+		Status: StatusPresent,
+	}
+
+	if src, ok := env.Which(rv.Key); ok {
+		rv.Source = src.Name()
+	}
+
+	if _, err := v.Get(env); err != nil {
+		rv.Error = err.Error()
+		switch {
+		case errors.As(err, new(platformsh.DecodeError)):
+			rv.Status = StatusMalformed
+		case errors.As(err, new(platformsh.MissingEnvironment)):
+			rv.Status = StatusMissing
+		default:
+			rv.Status = StatusMalformed
+		}
+	}
+	return rv
+}
+
+func checkListener(env platformsh.Environment) error {
+	l, err := env.Listener()
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+// checkRelationships dials every host of every relationship.
+func (c *Config) checkRelationships(env platformsh.Environment) []Check {
+	rels, err := env.Relationships()
+	if err != nil {
+		// reported with the variables
+		return []Check{}
+	}
+
+	names := make([]string, 0, len(rels))
+	for name := range rels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rv := make([]Check, 0, len(names))
+	for _, name := range names {
+		if len(rels[name]) == 0 {
+			rv = append(rv, newCheck(name, errors.New("no hosts")))
+			continue
+		}
+
+		for _, rel := range rels[name] {
+			addr := rel.HostPort()
+			conn, err := net.DialTimeout("tcp", addr, c.Timeout)
+			if err == nil {
+				err = conn.Close()
+			}
+			rv = append(rv, newCheck(name+"/"+addr, err))
+		}
+	}
+	return rv
+}
+
+func checkPKI(env platformsh.Environment) error {
+	lookup := func(name string) (string, error) {
+		v, ok := env.Lookup(name)
+		if !ok {
+			return "", errors.Errorf("%s not found in environment", name)
+		}
+		return v, nil
+	}
+
+	rootPem, err := lookup("PKI_ROOT_CERTIFICATE")
+	if err != nil {
+		return err
+	}
+	intermediatePem, err := lookup("PKI_INTERMEDIATE_CERTIFICATE")
+	if err != nil {
+		return err
+	}
+	intermediateKeyPem, err := lookup("PKI_INTERMEDIATE_PRIVATE_KEY")
+	if err != nil {
+		return err
+	}
+
+	var root pki.Certificate
+	if err := root.UnmarshalText([]byte(rootPem)); err != nil {
+		return errors.Wrap(err, "unable to unmarshal root certificate")
+	}
+	if root.Certificate == nil {
+		return errors.New("empty root certificate")
+	}
+
+	b := pki.Bundle{Name: "intermediate"}
+	if err := b.Cert.UnmarshalText([]byte(intermediatePem)); err != nil {
+		return errors.Wrap(err, "unable to unmarshal intermediate certificate")
+	}
+	if err := b.Key.UnmarshalText([]byte(intermediateKeyPem)); err != nil {
+		return errors.Wrap(err, "unable to unmarshal private key")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Certificate)
+	return b.Verify(roots, time.Now())
+}
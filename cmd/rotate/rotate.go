@@ -0,0 +1,82 @@
+package rotate
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/keyring"
+)
+
+type Config struct {
+	*app.App `flag:"-"`
+	Keep     int    `flag:"keep" desc:"How many key generations are kept; sessions signed by older ones are invalidated. 0 keeps every generation."`
+	Output   string `flag:"output o" desc:"Where the new generation is written"`
+}
+
+func New(app *app.App) app.Config {
+	return &Config{
+		App:    app,
+		Output: "-",
+	}
+}
+
+func (c *Config) Use() string {
+	return "rotate"
+}
+
+func (c *Config) Args(cmd *cobra.Command, args []string) error {
+	return cobra.NoArgs(cmd, args)
+}
+
+// Run adds a key generation; servers pick it up on SIGHUP or within their
+// watch interval.
+func (c *Config) Run(cmd *cobra.Command, args []string) error {
+	rels, err := c.Relationships()
+	if err != nil {
+		return errors.Wrap(err, "unable to locate relationships")
+	}
+
+	dsn, err := rels.Postgresql("database")
+	if err != nil {
+		return errors.Wrap(err, "unable to get database connection string")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return errors.Wrap(err, "unable to open database")
+	}
+	defer db.Close()
+
+	if err := keyring.EnsureSchema(c, db); err != nil {
+		return err
+	}
+
+	gen, err := keyring.Rotate(c, db)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("generation", gen).Info("rotated session keys")
+
+	if c.Keep > 0 {
+		n, err := keyring.Prune(c, db, c.Keep)
+		if err != nil {
+			return err
+		}
+		logrus.WithField("pruned", n).Info("pruned old key generations")
+	}
+
+	fp, err := c.GetOutput(c.Output)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	_, err = fmt.Fprintln(fp, gen)
+	return err
+}
@@ -1,13 +1,25 @@
 package serve
 
 import (
+	"time"
+
 	"github.com/demosdemon/super-potato/pkg/app"
 	"github.com/demosdemon/super-potato/pkg/server"
 )
 
 func New(app *app.App) app.Config {
 	return &server.Server{
-		App:           app,
-		SessionCookie: "super-potato",
+		App:             app,
+		SessionCookie:   "super-potato",
+		SessionStore:    "mongo",
+		SessionTTL:      30 * 24 * time.Hour,
+		SessionKeys:     3,
+		HealthInterval:  time.Minute,
+		ClientAuth:      "request",
+		DrainTimeout:    15 * time.Second,
+		AccessLogSample: 1,
+		RateLimits:      []string{"public=20/s:40:session", "env=10/s:20:dn"},
+		RateLimitStore:  "memory",
+		TempDir:         "/var/tmp",
 	}
 }
@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+type Config struct {
+	*app.App `flag:"-"`
+	Output   string   `flag:"output o" desc:"Where the output is written"`
+	Format   string   `flag:"format f" desc:"The output format; one of json, yaml"`
+	Redact   bool     `flag:"redact" desc:"Replace secrets and passwords with a placeholder; replaying the snapshot leaves them unset"`
+	Extra    []string `flag:"extra e" desc:"Additional environment variables to capture"`
+}
+
+func New(app *app.App) app.Config {
+	return &Config{
+		App:    app,
+		Output: "-",
+		Format: "json",
+	}
+}
+
+func (c *Config) Use() string {
+	return "snapshot"
+}
+
+func (c *Config) Args(cmd *cobra.Command, args []string) error {
+	return cobra.NoArgs(cmd, args)
+}
+
+func (c *Config) Run(cmd *cobra.Command, args []string) error {
+	fp, err := c.GetOutput(c.Output)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	snapshot := platformsh.TakeSnapshot(c.App.Environment, platformsh.SnapshotOptions{
+		Redact: c.Redact,
+		Extra:  c.Extra,
+	})
+	return snapshot.Write(fp, c.Format)
+}
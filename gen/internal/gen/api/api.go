@@ -12,10 +12,10 @@ import (
 )
 
 const (
-	logrusPath     = "github.com/sirupsen/logrus"
 	platformshPath = "github.com/demosdemon/super-potato/pkg/platformsh"
 	ginPath        = "github.com/gin-gonic/gin"
 	httpPath       = "net/http"
+	errorsPath     = "github.com/pkg/errors"
 )
 
 func init() {
@@ -68,13 +68,14 @@ func (l Collection) Render(w io.Writer) error {
 func getterDefinition(v variables.WellKnownVariable, name string) Code {
 	/*
 		func (s *Server) getApplication(c *gin.Context) {
-			logrus.Trace("getApplication")
+			getLogger(c).Trace("getApplication")
 			obj, err := s.Environment.Application()
-			_, ok := err.(platformsh.MissingEnvironment)
 			switch {
 			case err == nil:
 				s.negotiate(c, http.StatusOK, obj)
-			case ok:
+			case errors.As(err, new(platformsh.DecodeError)):
+				s.negotiate(c, http.StatusInternalServerError, err)
+			case errors.As(err, new(platformsh.MissingEnvironment)):
 				s.negotiate(c, http.StatusNotFound, err)
 			default:
 				s.negotiate(c, http.StatusInternalServerError, err)
@@ -82,23 +83,27 @@ func getterDefinition(v variables.WellKnownVariable, name string) Code {
 		}
 	*/
 	return Func().Params(receiver()).Id(name).Params(contextParam()).Block(
-		Qual(logrusPath, "Trace").Call(Lit(name)),
+		Id("getLogger").Call(Id("c")).Dot("Trace").Call(Lit(name)),
 		List(
 			Id("obj"),
 			Err(),
 		).Op(":=").Id("s").Dot("Environment").Dot(v.Name).Call(),
-		List(
-			Id("_"),
-			Id("ok"),
-		).Op(":=").Err().Assert(Qual(platformshPath, "MissingEnvironment")),
 		Switch().Block(
 			Case(Err().Op("==").Nil()).Block(negotiate("StatusOK", Id("obj"))),
-			Case(Id("ok")).Block(negotiate("StatusNotFound", Err())),
+			Case(errorsAs("DecodeError")).Block(negotiate("StatusInternalServerError", Err())),
+			Case(errorsAs("MissingEnvironment")).Block(negotiate("StatusNotFound", Err())),
 			Default().Block(negotiate("StatusInternalServerError", Err())),
 		),
 	).Line()
 }
 
+func errorsAs(typ string) Code {
+	return Qual(errorsPath, "As").Call(
+		Err(),
+		New(Qual(platformshPath, typ)),
+	)
+}
+
 func negotiate(status string, result Code) Code {
 	return Id("s").Dot("negotiate").Call(
 		Id("c"),
@@ -88,7 +88,7 @@ package server
 import (
 	platformsh "github.com/demosdemon/super-potato/pkg/platformsh"
 	gin "github.com/gin-gonic/gin"
-	logrus "github.com/sirupsen/logrus"
+	errors "github.com/pkg/errors"
 	"net/http"
 )
 
@@ -97,13 +97,14 @@ func (s *Server) registerGeneratedRoutes(r gin.IRoutes) {
 }
 
 func (s *Server) getone(c *gin.Context) {
-	logrus.Trace("getone")
+	getLogger(c).Trace("getone")
 	obj, err := s.Environment.one()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -127,7 +128,7 @@ package server
 import (
 	platformsh "github.com/demosdemon/super-potato/pkg/platformsh"
 	gin "github.com/gin-gonic/gin"
-	logrus "github.com/sirupsen/logrus"
+	errors "github.com/pkg/errors"
 	"net/http"
 )
 
@@ -138,13 +139,14 @@ func (s *Server) registerGeneratedRoutes(r gin.IRoutes) {
 }
 
 func (s *Server) getOne(c *gin.Context) {
-	logrus.Trace("getOne")
+	getLogger(c).Trace("getOne")
 	obj, err := s.Environment.One()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -22,6 +22,7 @@ type WellKnownVariable struct {
 	Aliases        []string `yaml:"aliases"`
 	DecodedType    string   `yaml:"decoded_type"`
 	DecodedPointer bool     `yaml:"decoded_pointer"`
+	Secret         bool     `yaml:"secret"`
 }
 
 func NewCollection(r io.Reader) (gen.Renderer, error) {
@@ -42,6 +43,16 @@ func (l Collection) Render(w io.Writer) error {
 		}
 	}).Line()
 
+	file.Comment("WellKnownVariables describes the variables behind EnvironmentAPI.")
+	file.Var().Id("WellKnownVariables").Op("=").Index().Id("WellKnownVariable").ValuesFunc(func(g *Group) {
+		for _, v := range l {
+			g.Line().Add(v.tableEntry())
+		}
+		if len(l) > 0 {
+			g.Line()
+		}
+	})
+
 	return file.Render(w)
 }
 
@@ -63,6 +74,43 @@ func (v WellKnownVariable) definition(g *Group) *Statement {
 	return stmts
 }
 
+func (v WellKnownVariable) tableEntry() Code {
+	/*
+		{
+			Decoded: true,
+			EnvName: "APPLICATION",
+			Get: func(e EnvironmentAPI) (interface{}, error) {
+				return e.Application()
+			},
+			Name: "Application",
+		}
+	*/
+
+	name := strcase.ToCamel(v.Name)
+	dict := Dict{
+		Id("Name"):    Lit(name),
+		Id("EnvName"): Lit(strcase.ToScreamingSnake(v.Name)),
+		Id("Get"): Func().Params(
+			Id("e").Id("EnvironmentAPI"),
+		).Params(
+			Interface(),
+			Error(),
+		).Block(
+			Return(Id("e").Dot(name).Call()),
+		),
+	}
+	if v.NoPrefix {
+		dict[Id("NoPrefix")] = True()
+	}
+	if v.DecodedType != "" {
+		dict[Id("Decoded")] = True()
+	}
+	if v.Secret {
+		dict[Id("Secret")] = True()
+	}
+	return Values(dict)
+}
+
 func (v WellKnownVariable) funcInterface(name string) Code {
 	return Id(name).Params().ParamsFunc(v.returnParams)
 }
@@ -76,17 +124,22 @@ func (v WellKnownVariable) function(name string) Code {
 				return nil, missingEnvironment(name)
 			}
 
+			if cached, ok := e.cached(name, value); ok {
+				return cached.(*Application), nil
+			}
+
 			data, err := base64.StdEncoding.DecodeString(value)
 			if err != nil {
-				return nil, MissingEnvironment{name, err}
+				return nil, DecodeError{name, err}
 			}
 
 			app := Application{}
 			err = json.Unmarshal(data, &app)
 			if err != nil {
-				return nil, MissingEnvironment{name, err}
+				return nil, DecodeError{name, err}
 			}
 
+			e.setCached(name, value, &app)
 			return &app, nil
 		}
 	*/
@@ -115,6 +168,8 @@ func (v WellKnownVariable) returnValue(g *Group) {
 	}
 
 	// must be done one at a time even though the method is variadic
+	g.Add(v.ifCached())
+	g.Line()
 	g.Add(decodeData())
 	g.Add(v.ifErrNotNil())
 	g.Line()
@@ -122,6 +177,7 @@ func (v WellKnownVariable) returnValue(g *Group) {
 	g.Add(unmarshalObj())
 	g.Add(v.ifErrNotNil())
 	g.Line()
+	g.Add(v.setCached())
 	g.Return(v.returnValueStmt(), Nil())
 }
 
@@ -171,13 +227,39 @@ func (v WellKnownVariable) ifNotOk() Code {
 	)
 }
 
+func (v WellKnownVariable) ifCached() Code {
+	return If(
+		List(
+			Id("cached"),
+			Id("ok"),
+		).Op(":=").Id("e").Dot("cached").Call(
+			Id("name"),
+			Id("value"),
+		),
+		Id("ok"),
+	).Block(
+		Return(
+			Id("cached").Assert(v.returnType()),
+			Nil(),
+		),
+	)
+}
+
+func (v WellKnownVariable) setCached() Code {
+	return Id("e").Dot("setCached").Call(
+		Id("name"),
+		Id("value"),
+		v.returnValueStmt(),
+	)
+}
+
 func (v WellKnownVariable) ifErrNotNil() Code {
 	return If(
 		Err().Op("!=").Nil(),
 	).Block(
 		Return(
 			v.zeroValue(),
-			Id("MissingEnvironment").Values(
+			Id("DecodeError").Values(
 				Id("name"),
 				Err(),
 			),
@@ -61,6 +61,9 @@ func TestCollection_Render(t *testing.T) {
 package platformsh
 
 type EnvironmentAPI interface{}
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{}
 `,
 		},
 		{
@@ -83,6 +86,17 @@ func (e *environment) One() (string, error) {
 
 	return value, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name: "One",
+	},
+}
 `,
 		},
 		{
@@ -105,6 +119,18 @@ func (e *environment) One() (string, error) {
 
 	return value, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name:     "One",
+		NoPrefix: true,
+	},
+}
 `,
 		},
 		{
@@ -149,6 +175,17 @@ func (e *environment) Three() (string, error) {
 
 	return value, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name: "One",
+	},
+}
 `,
 		},
 		{
@@ -174,19 +211,36 @@ func (e *environment) One() (Decoded, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(Decoded), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := Decoded{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, obj)
 	return obj, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		Decoded: true,
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name: "One",
+	},
+}
 `,
 		},
 		{
@@ -212,19 +266,70 @@ func (e *environment) One() (*Decoded, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(*Decoded), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := Decoded{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, &obj)
 	return &obj, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		Decoded: true,
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name: "One",
+	},
+}
+`,
+		},
+		{
+			name: "one secret",
+			l:    Collection{{Name: "one", Secret: true}},
+			wantW: `// This file is generated - do not edit!
+
+package platformsh
+
+type EnvironmentAPI interface {
+	One() (string, error)
+}
+
+func (e *environment) One() (string, error) {
+	name := e.Prefix() + "ONE"
+	value, ok := e.Lookup(name)
+	if !ok {
+		return "", missingEnvironment(name)
+	}
+
+	return value, nil
+}
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		EnvName: "ONE",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.One()
+		},
+		Name:   "One",
+		Secret: true,
+	},
+}
 `,
 		},
 	}
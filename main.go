@@ -5,22 +5,33 @@ package main
 import (
 	"context"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 
 	"github.com/demosdemon/super-potato/cmd/deploy"
+	"github.com/demosdemon/super-potato/cmd/doctor"
 	"github.com/demosdemon/super-potato/cmd/dump"
+	"github.com/demosdemon/super-potato/cmd/rotate"
 	"github.com/demosdemon/super-potato/cmd/scrape"
 	"github.com/demosdemon/super-potato/cmd/secret"
 	"github.com/demosdemon/super-potato/cmd/serve"
+	"github.com/demosdemon/super-potato/cmd/snapshot"
 	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/platformsh"
 )
 
 type Config struct {
-	*app.App  `flag:"-"`
-	LogLevel  string `flag:"log-level l" desc:"The logging verbosity"`
-	LogOutput string `flag:"log-output" desc:"Where logging is written"`
-	Prefix    string `flag:"prefix" desc:"The prefix for Platform.sh environment variables."`
+	*app.App   `flag:"-"`
+	LogLevel   string `flag:"log-level l" desc:"The logging verbosity"`
+	LogOutput  string `flag:"log-output" desc:"Where logging is written"`
+	LogFormat  string `flag:"log-format" desc:"How logging is formatted: text or json"`
+	Prefix     string `flag:"prefix" desc:"The prefix for Platform.sh environment variables."`
+	ConfigFile string `flag:"config-file" desc:"A YAML or JSON file of environment variables; takes precedence over the process environment."`
+	SecretsDir string `flag:"secrets-dir" desc:"A directory with one file per environment variable; takes precedence over the config file."`
+	Snapshot   string `flag:"snapshot" desc:"Replay an environment snapshot; takes precedence over the config file."`
+	DotEnvRank string `flag:"dotenv" desc:"Where the .env files rank among the variable sources: first, last or off."`
 }
 
 func (c *Config) Use() string {
@@ -42,14 +53,79 @@ func (c *Config) PersistentPreRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	switch c.LogFormat {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return errors.Errorf("unknown log format %q", c.LogFormat)
+	}
+
 	logrus.SetLevel(level)
 	logrus.SetOutput(fp)
 	c.SetPrefix(c.Prefix)
+	if err := c.setSources(); err != nil {
+		return err
+	}
 
 	logrus.Trace("program beginning")
 	return nil
 }
 
+func (c *Config) setSources() error {
+	fs := afero.NewOsFs()
+	var sources []platformsh.VariableSource
+	if c.SecretsDir != "" {
+		sources = append(sources, platformsh.SecretsDirSource(fs, c.SecretsDir))
+	}
+	if c.Snapshot != "" {
+		src, err := c.snapshotSource()
+		if err != nil {
+			return err
+		}
+		sources = append(sources, src)
+	}
+	if c.ConfigFile != "" {
+		src, err := platformsh.NewConfigFileSource(fs, c.ConfigFile)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, src)
+	}
+	sources = append(sources, platformsh.ProcessEnv())
+
+	switch c.DotEnvRank {
+	case "first":
+		sources = append([]platformsh.VariableSource{c.DotEnv()}, sources...)
+	case "last":
+		sources = append(sources, c.DotEnv())
+	case "off":
+	default:
+		return errors.Errorf("unknown dotenv rank %q", c.DotEnvRank)
+	}
+
+	c.SetSources(sources...)
+	return nil
+}
+
+func (c *Config) snapshotSource() (platformsh.VariableSource, error) {
+	fp, err := c.GetInput(c.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	snapshot, err := platformsh.ReadSnapshot(fp)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Prefix != c.Prefix {
+		logrus.WithField("prefix", snapshot.Prefix).Warn("snapshot was taken with a different prefix")
+	}
+	return snapshot.Source()
+}
+
 func (c *Config) PersistentPostRun(cmd *cobra.Command, args []string) error {
 	logrus.Trace("program ending")
 	return nil
@@ -58,20 +134,25 @@ func (c *Config) PersistentPostRun(cmd *cobra.Command, args []string) error {
 func (c *Config) SubCommands() []app.Config {
 	return []app.Config{
 		deploy.New(c.App),
+		doctor.New(c.App),
 		dump.New(c.App),
+		rotate.New(c.App),
 		scrape.New(c.App),
 		secret.New(c.App),
 		serve.New(c.App),
+		snapshot.New(c.App),
 	}
 }
 
 func main() {
 	inst, cancel := app.New(context.Background())
 	inst.Execute(&Config{
-		App:       inst,
-		LogLevel:  "trace",
-		LogOutput: "/dev/stderr",
-		Prefix:    "PLATFORM_",
+		App:        inst,
+		LogLevel:   "trace",
+		LogOutput:  "/dev/stderr",
+		LogFormat:  "text",
+		Prefix:     "PLATFORM_",
+		DotEnvRank: "first",
 	})
 	cancel()
 }
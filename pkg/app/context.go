@@ -29,3 +29,22 @@ func CancelOnSignal(ctx context.Context, signals ...os.Signal) (context.Context,
 
 	return ctx, cancel
 }
+
+// OnSignal calls fn for every signal received until ctx is done.
+func OnSignal(ctx context.Context, fn func(os.Signal), signals ...os.Signal) {
+	ch := make(chan os.Signal, len(signals))
+	signal.Notify(ch, signals...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case sig := <-ch:
+				logrus.WithField("signal", sig).Debug("received signal")
+				fn(sig)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
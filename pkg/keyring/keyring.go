@@ -0,0 +1,69 @@
+// Package keyring derives generations of session keys from a master secret
+// with HKDF, so that keys can be rotated without storing them.
+package keyring
+
+import (
+	"crypto/sha256"
+	"io"
+	"sort"
+	"strconv"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeySize is the size of both the signing and the encryption key; the
+// latter selects AES-256.
+const KeySize = 32
+
+const info = "super-potato session keys v1 generation "
+
+type Key struct {
+	Generation int
+	Hash       []byte
+	Block      []byte
+}
+
+// Ring holds the keys of several generations, newest first.
+type Ring []Key
+
+// Derive returns the keys of the given generations. The same master and
+// generation always produce the same key.
+func Derive(master []byte, generations ...int) Ring {
+	gens := append([]int(nil), generations...)
+	sort.Sort(sort.Reverse(sort.IntSlice(gens)))
+
+	rv := make(Ring, 0, len(gens))
+	for idx, gen := range gens {
+		if idx > 0 && gen == gens[idx-1] {
+			continue
+		}
+
+		buf := make([]byte, 2*KeySize)
+		r := hkdf.New(sha256.New, master, nil, []byte(info+strconv.Itoa(gen)))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			// only possible when reading more than 255 hashes
+			panic(err)
+		}
+		rv = append(rv, Key{Generation: gen, Hash: buf[:KeySize], Block: buf[KeySize:]})
+	}
+	return rv
+}
+
+// Current returns the newest generation, or -1 for an empty ring.
+func (r Ring) Current() int {
+	if len(r) == 0 {
+		return -1
+	}
+	return r[0].Generation
+}
+
+// Pairs returns hash and block key pairs, newest first, as expected by
+// securecookie.CodecsFromPairs: values are encoded with the newest key and
+// decoded with any of them.
+func (r Ring) Pairs() [][]byte {
+	rv := make([][]byte, 0, 2*len(r))
+	for _, k := range r {
+		rv = append(rv, k.Hash, k.Block)
+	}
+	return rv
+}
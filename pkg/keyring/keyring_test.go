@@ -0,0 +1,54 @@
+package keyring_test
+
+import (
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/keyring"
+)
+
+func TestDerive(t *testing.T) {
+	master := []byte("project entropy")
+
+	ring := Derive(master, 0, 2, 1, 2)
+	require.Len(t, ring, 3)
+	assert.Equal(t, 2, ring.Current())
+	assert.Equal(t, []int{2, 1, 0}, []int{ring[0].Generation, ring[1].Generation, ring[2].Generation})
+
+	for _, k := range ring {
+		assert.Len(t, k.Hash, KeySize)
+		assert.Len(t, k.Block, KeySize)
+		assert.NotEqual(t, k.Hash, k.Block)
+	}
+	assert.NotEqual(t, ring[0].Hash, ring[1].Hash)
+
+	// derivation is deterministic and depends on the master
+	assert.Equal(t, ring[1], Derive(master, 1)[0])
+	assert.NotEqual(t, ring[1], Derive([]byte("other entropy"), 1)[0])
+
+	assert.Equal(t, -1, Derive(master).Current())
+}
+
+func TestRing_Pairs(t *testing.T) {
+	master := []byte("project entropy")
+	old := securecookie.CodecsFromPairs(Derive(master, 0).Pairs()...)
+	rotated := securecookie.CodecsFromPairs(Derive(master, 1, 0).Pairs()...)
+	other := securecookie.CodecsFromPairs(Derive([]byte("other entropy"), 1, 0).Pairs()...)
+
+	encoded, err := securecookie.EncodeMulti("session", "value", old...)
+	require.NoError(t, err)
+
+	// values encoded with an older generation still decode
+	var v string
+	require.NoError(t, securecookie.DecodeMulti("session", encoded, &v, rotated...))
+	assert.Equal(t, "value", v)
+	assert.Error(t, securecookie.DecodeMulti("session", encoded, &v, other...))
+
+	// new values use the newest generation
+	encoded, err = securecookie.EncodeMulti("session", "value", rotated...)
+	require.NoError(t, err)
+	assert.Error(t, securecookie.DecodeMulti("session", encoded, &v, old...))
+}
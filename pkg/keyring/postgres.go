@@ -0,0 +1,75 @@
+package keyring
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// The generations in use are kept in the session_keys table so that every
+// instance derives the same ring. Generation 0 is seeded so that sessions
+// signed before the first rotation stay valid after it.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS session_keys (
+	generation integer PRIMARY KEY,
+	created    timestamptz NOT NULL DEFAULT now()
+);
+INSERT INTO session_keys (generation) SELECT 0
+	WHERE NOT EXISTS (SELECT 1 FROM session_keys);
+`
+
+func EnsureSchema(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		return errors.Wrap(err, "unable to create the session_keys table")
+	}
+	return nil
+}
+
+// Generations returns up to limit of the newest generations, newest first.
+func Generations(ctx context.Context, db *sql.DB, limit int) ([]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT generation FROM session_keys ORDER BY generation DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rv []int
+	for rows.Next() {
+		var gen int
+		if err := rows.Scan(&gen); err != nil {
+			return nil, err
+		}
+		rv = append(rv, gen)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(rv) == 0 {
+		rv = []int{0}
+	}
+	return rv, nil
+}
+
+// Rotate adds the next generation and returns it.
+func Rotate(ctx context.Context, db *sql.DB) (int, error) {
+	var gen int
+	err := db.QueryRowContext(ctx, `INSERT INTO session_keys (generation)
+		SELECT COALESCE(MAX(generation), 0) + 1 FROM session_keys
+		RETURNING generation`).Scan(&gen)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to add a key generation")
+	}
+	return gen, nil
+}
+
+// Prune forgets all but the newest keep generations.
+func Prune(ctx context.Context, db *sql.DB, keep int) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM session_keys WHERE generation NOT IN (
+		SELECT generation FROM session_keys ORDER BY generation DESC LIMIT $1
+	)`, keep)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to prune key generations")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,315 @@
+// Package metrics implements counters, gauges and histograms that are
+// written in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are suited to HTTP request latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer, name string)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(errors.Errorf("metric %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText writes every metric, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		metrics[name].write(bw, name)
+	}
+	return bw.Flush()
+}
+
+type header struct {
+	help string
+	typ  string
+}
+
+func (h header) write(w *bufio.Writer, name string) {
+	w.WriteString("# HELP " + name + " " + escapeHelp(h.help) + "\n")
+	w.WriteString("# TYPE " + name + " " + h.typ + "\n")
+}
+
+// vec holds one value per combination of label values.
+type vec struct {
+	header
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	// histograms only
+	counts []uint64
+	sum    float64
+}
+
+func newVec(help, typ string, labels []string) vec {
+	return vec{
+		header: header{help, typ},
+		labels: labels,
+		values: make(map[string]*series),
+	}
+}
+
+// get must be called with v.mu held.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(errors.Errorf("expected %d label values, got %d", len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := v.values[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.values[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []series {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	rv := make([]series, 0, len(v.values))
+	for _, s := range v.values {
+		cp := *s
+		cp.counts = append([]uint64(nil), s.counts...)
+		rv = append(rv, cp)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return strings.Join(rv[i].labels, "\xff") < strings.Join(rv[j].labels, "\xff")
+	})
+	return rv
+}
+
+type Counter struct {
+	vec
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	rv := &Counter{newVec(help, "counter", labels)}
+	r.register(name, rv)
+	return rv
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add panics when v is negative; counters only go up.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(errors.New("counter cannot decrease"))
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer, name string) {
+	c.header.write(w, name)
+	for _, s := range c.sorted() {
+		writeSample(w, name, c.labels, s.labels, "", "", s.value)
+	}
+}
+
+type Gauge struct {
+	vec
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	rv := &Gauge{newVec(help, "gauge", labels)}
+	r.register(name, rv)
+	return rv
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer, name string) {
+	g.header.write(w, name)
+	for _, s := range g.sorted() {
+		writeSample(w, name, g.labels, s.labels, "", "", s.value)
+	}
+}
+
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram panics unless buckets are sorted. The +Inf bucket is implied.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(errors.Errorf("buckets for %s are not sorted", name))
+	}
+	rv := &Histogram{newVec(help, "histogram", labels), buckets}
+	r.register(name, rv)
+	return rv
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for idx, upper := range h.buckets {
+		if v <= upper {
+			s.counts[idx]++
+		}
+	}
+	s.value++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.header.write(w, name)
+	for _, s := range h.sorted() {
+		for idx, upper := range h.buckets {
+			writeSample(w, name+"_bucket", h.labels, s.labels, "le", formatFloat(upper), float64(s.counts[idx]))
+		}
+		writeSample(w, name+"_bucket", h.labels, s.labels, "le", "+Inf", s.value)
+		writeSample(w, name+"_sum", h.labels, s.labels, "", "", s.sum)
+		writeSample(w, name+"_count", h.labels, s.labels, "", "", s.value)
+	}
+}
+
+// Sample is a value reported by a func metric.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type funcMetric struct {
+	header
+	labels []string
+	fn     func() []Sample
+}
+
+// NewGaugeFunc reports the samples returned by fn when the registry is written.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(name, &funcMetric{header{help, "gauge"}, labels, fn})
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only go up.
+func (r *Registry) NewCounterFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(name, &funcMetric{header{help, "counter"}, labels, fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer, name string) {
+	f.header.write(w, name)
+	for _, s := range f.fn() {
+		writeSample(w, name, f.labels, s.LabelValues, "", "", s.Value)
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for idx, label := range labels {
+			if idx > 0 {
+				w.WriteByte(',')
+			}
+			var value string
+			if idx < len(values) {
+				value = values[idx]
+			}
+			w.WriteString(label + `="` + escapeLabel(value) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
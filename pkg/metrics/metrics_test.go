@@ -0,0 +1,68 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/metrics"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("http_requests_total", "Requests served.", "method", "route")
+	requests.Inc("GET", "/ping")
+	requests.Add(2, "GET", "/ping")
+	requests.Inc("POST", `/say "hi"`)
+
+	up := r.NewGauge("up", "Whether the server is up.\nMultiline \\ help.")
+	up.Set(1)
+
+	latency := r.NewHistogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/ping")
+	latency.Observe(0.5, "/ping")
+	latency.Observe(5, "/ping")
+
+	r.NewGaugeFunc("temperature", "A func gauge.", func() []Sample {
+		return []Sample{
+			{LabelValues: []string{"inside"}, Value: 21.5},
+			{LabelValues: []string{"outside"}, Value: math.Inf(-1)},
+		}
+	}, "where")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(t, `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/ping"} 3
+http_requests_total{method="POST",route="/say \"hi\""} 1
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/ping",le="0.1"} 1
+latency_seconds_bucket{route="/ping",le="1"} 2
+latency_seconds_bucket{route="/ping",le="+Inf"} 3
+latency_seconds_sum{route="/ping"} 5.55
+latency_seconds_count{route="/ping"} 3
+# HELP temperature A func gauge.
+# TYPE temperature gauge
+temperature{where="inside"} 21.5
+temperature{where="outside"} -Inf
+# HELP up Whether the server is up.\nMultiline \\ help.
+# TYPE up gauge
+up 1
+`, buf.String())
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c", "A counter.", "label")
+
+	assert.Panics(t, func() { r.NewGauge("c", "Duplicate.") })
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "x") })
+	assert.Panics(t, func() { r.NewHistogram("h", "Unsorted.", []float64{1, 0.5}) })
+}
@@ -1,7 +1,45 @@
 package pki
 
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 type Bundle struct {
 	Name string
 	Cert Certificate
 	Key  PrivateKey
 }
+
+// Verify checks that the key matches the certificate, that the certificate
+// is valid at now and that it chains to one of the roots.
+func (b Bundle) Verify(roots *x509.CertPool, now time.Time) error {
+	if b.Cert.Certificate == nil {
+		return errors.New("missing certificate")
+	}
+	if b.Key.PrivateKey == nil {
+		return errors.New("missing private key")
+	}
+
+	pub, ok := b.Cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(b.Key.N) != 0 || pub.E != b.Key.E {
+		return errors.New("private key does not match certificate")
+	}
+
+	if now.Before(b.Cert.NotBefore) {
+		return errors.Errorf("certificate is not valid until %v", b.Cert.NotBefore)
+	}
+	if now.After(b.Cert.NotAfter) {
+		return errors.Errorf("certificate expired at %v", b.Cert.NotAfter)
+	}
+
+	_, err := b.Cert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return errors.Wrap(err, "certificate does not chain to the root")
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -45,6 +46,9 @@ func (c *Certificate) Unmarshal(mc MarshaledCertificate) error {
 	if err != nil {
 		return err
 	}
+	if pemBlock == nil {
+		return errors.New("invalid PEM data")
+	}
 
 	cert, err := x509.ParseCertificate(pemBlock.Bytes)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,6 +45,9 @@ func (pk *PrivateKey) UnmarshalText(text []byte) error {
 	if err != nil {
 		return err
 	}
+	if pemBlock == nil {
+		return errors.New("invalid PEM data")
+	}
 
 	var data []byte
 	if len(pk.secret) > 0 {
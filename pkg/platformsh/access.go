@@ -0,0 +1,135 @@
+package platformsh
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PermissionAllow = "allow"
+	PermissionDeny  = "deny"
+)
+
+// AccessAddress is a single `http_access.addresses` rule. The router also
+// accepts the shorthand string form "deny 10.0.0.0/8"; a bare address is
+// treated as an allow rule. Rules with another permission or an address that
+// doesn't parse are rejected when routes are loaded.
+type AccessAddress struct {
+	Permission string `json:"permission"`
+	Address    string `json:"address"`
+}
+
+func (a *AccessAddress) UnmarshalJSON(data []byte) error {
+	logrus.Trace("AccessAddress.UnmarshalJSON")
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return a.UnmarshalText([]byte(text))
+	}
+
+	type plain AccessAddress
+	if err := json.Unmarshal(data, (*plain)(a)); err != nil {
+		return err
+	}
+	return a.Validate()
+}
+
+func (a *AccessAddress) UnmarshalText(text []byte) error {
+	logrus.Trace("AccessAddress.UnmarshalText")
+	fields := strings.Fields(string(text))
+	switch len(fields) {
+	case 1:
+		*a = AccessAddress{Permission: PermissionAllow, Address: fields[0]}
+	case 2:
+		*a = AccessAddress{Permission: fields[0], Address: fields[1]}
+	default:
+		return fmt.Errorf("invalid access address %q", string(text))
+	}
+
+	return a.Validate()
+}
+
+func (a AccessAddress) Validate() error {
+	switch a.Permission {
+	case PermissionAllow, PermissionDeny:
+	default:
+		return fmt.Errorf("invalid access permission %q for %q", a.Permission, a.Address)
+	}
+
+	_, err := a.Network()
+	return err
+}
+
+func (a AccessAddress) Network() (*net.IPNet, error) {
+	if strings.Contains(a.Address, "/") {
+		_, network, err := net.ParseCIDR(a.Address)
+		return network, err
+	}
+
+	ip := net.ParseIP(a.Address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid access address %q", a.Address)
+	}
+
+	bits := 8 * net.IPv6len
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Restricted reports whether the route limits who may access it.
+func (h HTTPAccess) Restricted() bool {
+	return len(h.Addresses) > 0 || len(h.BasicAuth) > 0
+}
+
+// Allowed evaluates the address rules in order; the first rule containing ip
+// decides. Addresses that match no rule are allowed. An invalid rule denies
+// every address that reaches it.
+func (h HTTPAccess) Allowed(ip net.IP) bool {
+	logrus.Trace("HTTPAccess.Allowed")
+	for _, rule := range h.Addresses {
+		if err := rule.Validate(); err != nil {
+			logrus.WithError(err).Warn("denying access on an invalid access rule")
+			return false
+		}
+
+		network, _ := rule.Network()
+		if network.Contains(ip) {
+			return rule.Permission == PermissionAllow
+		}
+	}
+
+	return true
+}
+
+// Restricted reports whether any route limits who may access it.
+func (r Routes) Restricted() bool {
+	for _, route := range r {
+		if route.HTTPAccess.Restricted() {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorized reports whether the credentials satisfy BasicAuth. Routes
+// without BasicAuth credentials authorize everyone.
+func (h HTTPAccess) Authorized(username, password string) bool {
+	logrus.Trace("HTTPAccess.Authorized")
+	if len(h.BasicAuth) == 0 {
+		return true
+	}
+
+	expected, ok := h.BasicAuth[username]
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
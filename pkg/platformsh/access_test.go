@@ -0,0 +1,86 @@
+package platformsh_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func TestAccessAddress_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    AccessAddress
+		wantErr bool
+	}{
+		{"object", `{"permission": "deny", "address": "10.0.0.0/8"}`, AccessAddress{"deny", "10.0.0.0/8"}, false},
+		{"string", `"deny 10.0.0.0/8"`, AccessAddress{"deny", "10.0.0.0/8"}, false},
+		{"bare", `"192.0.2.1"`, AccessAddress{"allow", "192.0.2.1"}, false},
+		{"invalid", `"deny 10.0.0.0/8 extra"`, AccessAddress{}, true},
+		{"unknown permission", `"block 10.0.0.0/8"`, AccessAddress{}, true},
+		{"unknown object permission", `{"permission": "allowed", "address": "10.0.0.0/8"}`, AccessAddress{}, true},
+		{"invalid address", `"deny not-an-address"`, AccessAddress{}, true},
+		{"invalid object address", `{"permission": "deny", "address": "10.0.0.0/33"}`, AccessAddress{}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var rv AccessAddress
+			err := json.Unmarshal([]byte(tt.input), &rv)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rv)
+		})
+	}
+}
+
+func TestHTTPAccess_Allowed(t *testing.T) {
+	access := HTTPAccess{
+		Addresses: []AccessAddress{
+			{PermissionDeny, "192.0.2.13"},
+			{PermissionAllow, "192.0.2.0/24"},
+			{PermissionAllow, "2001:db8::/32"},
+			{PermissionDeny, "not an address"},
+			{PermissionDeny, "0.0.0.0/0"},
+		},
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.1", true},
+		{"192.0.2.13", false},
+		{"198.51.100.1", false},
+		{"2001:db8::1", true},
+		// the invalid rule denies everything after it
+		{"2001:db9::1", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, access.Allowed(net.ParseIP(tt.ip)))
+		})
+	}
+
+	assert.True(t, HTTPAccess{}.Allowed(net.ParseIP("192.0.2.1")))
+	assert.False(t, HTTPAccess{Addresses: []AccessAddress{{"Allow", "192.0.2.0/24"}}}.Allowed(net.ParseIP("192.0.2.1")))
+}
+
+func TestHTTPAccess_Authorized(t *testing.T) {
+	access := HTTPAccess{BasicAuth: map[string]string{"admin": "hunter2"}}
+	assert.True(t, access.Authorized("admin", "hunter2"))
+	assert.False(t, access.Authorized("admin", "hunter3"))
+	assert.False(t, access.Authorized("root", "hunter2"))
+	assert.True(t, HTTPAccess{}.Authorized("", ""))
+}
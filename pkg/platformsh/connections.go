@@ -0,0 +1,461 @@
+package platformsh
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxAttempts = 10
+	DefaultMinBackoff  = 100 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+)
+
+// Client is an open connection to a relationship host.
+type Client interface {
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Dialer opens a Client to a single host of a relationship.
+type Dialer func(ctx context.Context, rel Relationship) (Client, error)
+
+type ConnectionStatus struct {
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Healthy   bool      `json:"healthy"`
+	Failures  int       `json:"failures"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Connections opens and caches a Client per relationship name. Dialing is
+// retried with exponential backoff, rotating through the hosts of the
+// relationship, until MaxAttempts is exhausted or Close is called.
+//
+// Connections outlive the context of the application: requests still being
+// drained after a shutdown signal need them, so the owner calls Close once
+// nothing uses them anymore.
+type Connections struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	rels   Relationships
+
+	mu    sync.Mutex
+	conns map[string]*connection
+}
+
+type connection struct {
+	name    string
+	dial    Dialer
+	onOpen  []func(Client)
+	host    int
+	client  Client
+	status  ConnectionStatus
+	dialing sync.Mutex
+}
+
+type MongoDBClient struct {
+	*mgo.Session
+	Database string
+}
+
+type SQLClient struct {
+	*sql.DB
+}
+
+func NewConnections(rels Relationships) *Connections {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Connections{
+		MaxAttempts: DefaultMaxAttempts,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		ctx:         ctx,
+		cancel:      cancel,
+		rels:        rels,
+		conns:       make(map[string]*connection),
+	}
+}
+
+func (c *Connections) Register(name string, dial Dialer) {
+	conn := &connection{
+		name:   name,
+		dial:   dial,
+		status: ConnectionStatus{Name: name},
+	}
+
+	c.mu.Lock()
+	c.conns[name] = conn
+	c.mu.Unlock()
+}
+
+// OnOpen registers fn to be called every time a new client is opened for
+// name, including after a failover.
+func (c *Connections) OnOpen(name string, fn func(Client)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[name]; ok {
+		conn.onOpen = append(conn.onOpen, fn)
+	}
+}
+
+func (c *Connections) connection(name string) (*connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conn, ok := c.conns[name]
+	if !ok {
+		return nil, errors.Errorf("no dialer registered for relationship %q", name)
+	}
+	return conn, nil
+}
+
+func (c *Connections) Get(name string) (Client, error) {
+	conn, err := c.connection(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	client := conn.client
+	c.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	return c.open(conn, c.MaxAttempts)
+}
+
+func (c *Connections) MongoDB(name string) (*mgo.Database, error) {
+	client, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mongo, ok := client.(*MongoDBClient)
+	if !ok {
+		return nil, errors.Errorf("relationship %q is not a mongodb connection", name)
+	}
+	return mongo.DB(mongo.Database), nil
+}
+
+func (c *Connections) SQL(name string) (*sql.DB, error) {
+	client, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := client.(*SQLClient)
+	if !ok {
+		return nil, errors.Errorf("relationship %q is not a sql connection", name)
+	}
+	return db.DB, nil
+}
+
+// open dials the hosts of the relationship in turn, up to attempts times.
+func (c *Connections) open(conn *connection, attempts int) (Client, error) {
+	conn.dialing.Lock()
+	defer conn.dialing.Unlock()
+
+	c.mu.Lock()
+	if client := conn.client; client != nil {
+		c.mu.Unlock()
+		return client, nil
+	}
+	start := conn.host
+	c.mu.Unlock()
+
+	if err := c.ctx.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to %q", conn.name)
+	}
+
+	rels, err := c.rels.lookup(conn.name)
+	if err != nil {
+		c.record(conn, "", err)
+		return nil, err
+	}
+
+	backoff := c.MinBackoff
+	for attempt := 0; attempt < attempts; attempt++ {
+		host := (start + attempt) % len(rels)
+		rel := rels[host]
+
+		client, err := conn.dial(c.ctx, rel)
+		if err == nil && c.ctx.Err() != nil {
+			// closed while dialing
+			_ = client.Close()
+			return nil, errors.Wrapf(c.ctx.Err(), "unable to connect to %q", conn.name)
+		}
+		if err == nil {
+			c.mu.Lock()
+			conn.client = client
+			conn.host = host
+			callbacks := conn.onOpen
+			c.mu.Unlock()
+
+			c.record(conn, rel.HostPort(), nil)
+			for _, fn := range callbacks {
+				fn(client)
+			}
+			return client, nil
+		}
+
+		c.record(conn, rel.HostPort(), err)
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"relationship": conn.name,
+			"host":         rel.HostPort(),
+			"attempt":      attempt + 1,
+			"backoff":      backoff,
+		}).Warn("failed to connect to relationship")
+
+		if attempt+1 == attempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return nil, errors.Wrapf(c.ctx.Err(), "unable to connect to %q", conn.name)
+		}
+
+		backoff *= 2
+		if backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+
+	// the next open starts with the host after the last one tried
+	c.mu.Lock()
+	conn.host = (start + attempts) % len(rels)
+	c.mu.Unlock()
+
+	return nil, errors.Errorf("unable to connect to %q after %d attempts", conn.name, attempts)
+}
+
+func (c *Connections) record(conn *connection, host string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn.status.LastCheck = time.Now()
+	if host != "" {
+		conn.status.Host = host
+	}
+	if err != nil {
+		conn.status.Healthy = false
+		conn.status.Failures++
+		conn.status.LastError = err.Error()
+	} else {
+		conn.status.Healthy = true
+		conn.status.Failures = 0
+		conn.status.LastError = ""
+	}
+}
+
+func (c *Connections) connectionStatus(conn *connection) ConnectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return conn.status
+}
+
+func (c *Connections) Status() []ConnectionStatus {
+	c.mu.Lock()
+	conns := make([]*connection, 0, len(c.conns))
+	for _, conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.mu.Unlock()
+
+	rv := make([]ConnectionStatus, len(conns))
+	for idx, conn := range conns {
+		rv[idx] = c.connectionStatus(conn)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+var (
+	publishedMu sync.Mutex
+	published   = make(map[string]*Connections)
+)
+
+// Publish exposes Status as the expvar name. expvar names can't be
+// unpublished, so publishing another Connections under the same name
+// replaces the first.
+func (c *Connections) Publish(name string) {
+	publishedMu.Lock()
+	defer publishedMu.Unlock()
+
+	if _, ok := published[name]; !ok {
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			publishedMu.Lock()
+			conns := published[name]
+			publishedMu.Unlock()
+			return conns.Status()
+		}))
+	}
+	published[name] = c
+}
+
+func (c *Connections) Healthy() bool {
+	for _, status := range c.Status() {
+		if !status.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Check pings every open client. A client that fails its ping is closed and
+// the relationship fails over to its next host. Relationships without a
+// client are dialed once, so that one that is down doesn't hold up the
+// others; Get still retries with backoff.
+func (c *Connections) Check() {
+	c.mu.Lock()
+	conns := make([]*connection, 0, len(c.conns))
+	for _, conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.mu.Unlock()
+
+	for _, conn := range conns {
+		c.mu.Lock()
+		client := conn.client
+		c.mu.Unlock()
+
+		if client == nil {
+			if _, err := c.open(conn, 1); err != nil {
+				logrus.WithError(err).WithField("relationship", conn.name).Warn("health check failed")
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+		err := client.Ping(ctx)
+		cancel()
+		c.record(conn, "", err)
+		if err == nil {
+			continue
+		}
+
+		logrus.WithError(err).WithField("relationship", conn.name).Warn("health check failed; failing over")
+		c.mu.Lock()
+		conn.client = nil
+		conn.host++
+		c.mu.Unlock()
+
+		if _, err := c.open(conn, 1); err != nil {
+			logrus.WithError(err).WithField("relationship", conn.name).Error("failover failed")
+		}
+		if err := client.Close(); err != nil {
+			logrus.WithError(err).WithField("relationship", conn.name).Warn("error closing client")
+		}
+	}
+}
+
+// HealthCheck runs Check every interval until Close is called.
+func (c *Connections) HealthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Check()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops health checks and pending dials, and closes every client.
+// Later calls to Get fail.
+func (c *Connections) Close() {
+	c.cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		if conn.client == nil {
+			continue
+		}
+		if err := conn.client.Close(); err != nil {
+			logrus.WithError(err).WithField("relationship", conn.name).Warn("error closing client")
+		}
+		conn.client = nil
+	}
+}
+
+func MongoDBDialer(ctx context.Context, rel Relationship) (Client, error) {
+	info := mgo.DialInfo{
+		Addrs:    []string{rel.HostPort()},
+		Database: rel.Path,
+		Username: rel.Username,
+		Password: rel.Password,
+		Timeout:  10 * time.Second,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		info.Timeout = time.Until(deadline)
+	}
+
+	sess, err := mgo.DialWithInfo(&info)
+	if err != nil {
+		return nil, err
+	}
+	return &MongoDBClient{Session: sess, Database: rel.Path}, nil
+}
+
+func (c *MongoDBClient) Ping(ctx context.Context) error {
+	return c.Session.Ping()
+}
+
+func (c *MongoDBClient) Close() error {
+	c.Session.Close()
+	return nil
+}
+
+// PostgresqlDialer can't use inline certificates; see PostgresqlDriverDialer.
+func PostgresqlDialer(ctx context.Context, rel Relationship) (Client, error) {
+	return dialPostgresql(ctx, rel, "postgres", nil)
+}
+
+// PostgresqlDriverDialer is PostgresqlDialer using a different registered
+// database/sql driver, e.g. one that wraps lib/pq. Inline certificates are
+// written with files, which the caller closes once the connections are.
+func PostgresqlDriverDialer(driverName string, files *PEMFiles) Dialer {
+	return func(ctx context.Context, rel Relationship) (Client, error) {
+		return dialPostgresql(ctx, rel, driverName, files)
+	}
+}
+
+func dialPostgresql(ctx context.Context, rel Relationship, driverName string, files *PEMFiles) (Client, error) {
+	dsn, err := rel.postgresql(files)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLClient{DB: db}, nil
+}
+
+func (c *SQLClient) Ping(ctx context.Context) error {
+	return c.DB.PingContext(ctx)
+}
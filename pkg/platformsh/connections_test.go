@@ -0,0 +1,175 @@
+package platformsh_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+type fakeClient struct {
+	host   string
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+func (c *fakeClient) Ping(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *fakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+type fakeDialer struct {
+	mu      sync.Mutex
+	down    map[string]bool
+	dialed  []string
+	clients []*fakeClient
+}
+
+func (d *fakeDialer) Dial(_ context.Context, rel Relationship) (Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dialed = append(d.dialed, rel.Host)
+	if d.down[rel.Host] {
+		return nil, errors.New("connection refused")
+	}
+	client := &fakeClient{host: rel.Host}
+	d.clients = append(d.clients, client)
+	return client, nil
+}
+
+func newTestConnections(dialer *fakeDialer) *Connections {
+	conns := NewConnections(Relationships{
+		"db": {
+			{Host: "db1.internal", Port: 5432},
+			{Host: "db2.internal", Port: 5432},
+		},
+	})
+	conns.MinBackoff = time.Millisecond
+	conns.MaxBackoff = time.Millisecond
+	conns.MaxAttempts = 4
+	conns.Register("db", dialer.Dial)
+	return conns
+}
+
+func TestConnections_Get(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{"db1.internal": true}}
+	conns := newTestConnections(dialer)
+
+	var opened []Client
+	conns.OnOpen("db", func(c Client) { opened = append(opened, c) })
+
+	client, err := conns.Get("db")
+	require.NoError(t, err)
+	assert.Equal(t, "db2.internal", client.(*fakeClient).host)
+	assert.Equal(t, []string{"db1.internal", "db2.internal"}, dialer.dialed)
+	assert.Equal(t, []Client{client}, opened)
+
+	cached, err := conns.Get("db")
+	require.NoError(t, err)
+	assert.Equal(t, client, cached)
+	assert.Len(t, dialer.dialed, 2)
+
+	status := conns.Status()
+	require.Len(t, status, 1)
+	assert.True(t, status[0].Healthy)
+	assert.Equal(t, "db2.internal:5432", status[0].Host)
+
+	_, err = conns.Get("missing")
+	assert.Error(t, err)
+}
+
+func TestConnections_Exhausted(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{"db1.internal": true, "db2.internal": true}}
+	conns := newTestConnections(dialer)
+
+	_, err := conns.Get("db")
+	assert.Error(t, err)
+	assert.Len(t, dialer.dialed, 4)
+	assert.False(t, conns.Healthy())
+}
+
+func TestConnections_Close(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{}}
+	conns := newTestConnections(dialer)
+
+	client, err := conns.Get("db")
+	require.NoError(t, err)
+
+	conns.Close()
+	assert.True(t, client.(*fakeClient).closed)
+
+	_, err = conns.Get("db")
+	assert.Error(t, err)
+	assert.Len(t, dialer.dialed, 1)
+}
+
+func TestConnections_Check(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{}}
+	conns := newTestConnections(dialer)
+
+	client, err := conns.Get("db")
+	require.NoError(t, err)
+	first := client.(*fakeClient)
+	assert.Equal(t, "db1.internal", first.host)
+
+	first.err = errors.New("gone away")
+	conns.Check()
+
+	client, err = conns.Get("db")
+	require.NoError(t, err)
+	assert.Equal(t, "db2.internal", client.(*fakeClient).host)
+	assert.True(t, first.closed)
+	assert.True(t, conns.Healthy())
+}
+
+func TestConnections_CheckDialsOnce(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{"db1.internal": true, "db2.internal": true}}
+	conns := newTestConnections(dialer)
+
+	conns.Check()
+	assert.Equal(t, []string{"db1.internal"}, dialer.dialed)
+	assert.False(t, conns.Healthy())
+
+	// the next check moves on to the next host
+	delete(dialer.down, "db2.internal")
+	conns.Check()
+	assert.Equal(t, []string{"db1.internal", "db2.internal"}, dialer.dialed)
+	assert.True(t, conns.Healthy())
+}
+
+func TestConnections_Publish(t *testing.T) {
+	dialer := &fakeDialer{down: map[string]bool{}}
+	first := newTestConnections(dialer)
+	first.Publish("test_connections")
+
+	conns := newTestConnections(dialer)
+	conns.Publish("test_connections")
+	_, err := conns.Get("db")
+	require.NoError(t, err)
+
+	v := expvar.Get("test_connections")
+	require.NotNil(t, v)
+
+	var status []ConnectionStatus
+	require.NoError(t, json.Unmarshal([]byte(v.String()), &status))
+	require.Len(t, status, 1)
+	assert.Equal(t, "db", status[0].Name)
+	assert.True(t, status[0].Healthy)
+}
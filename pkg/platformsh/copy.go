@@ -0,0 +1,83 @@
+package platformsh
+
+import (
+	"reflect"
+)
+
+// deepCopy copies maps, slices, pointers and the exported fields of structs
+// so that callers can't modify a value shared through the decode cache.
+// Unexported fields are copied shallowly.
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		rv := reflect.New(v.Type().Elem())
+		rv.Elem().Set(copyValue(v.Elem()))
+		return rv
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		rv := reflect.New(v.Type()).Elem()
+		rv.Set(copyValue(v.Elem()))
+		return rv
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		rv := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			rv.SetMapIndex(copyValue(iter.Key()), copyValue(iter.Value()))
+		}
+		return rv
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		rv := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		copyElements(rv, v)
+		return rv
+
+	case reflect.Array:
+		rv := reflect.New(v.Type()).Elem()
+		copyElements(rv, v)
+		return rv
+
+	case reflect.Struct:
+		rv := reflect.New(v.Type()).Elem()
+		rv.Set(v)
+		for idx := 0; idx < v.NumField(); idx++ {
+			if field := rv.Field(idx); field.CanSet() {
+				field.Set(copyValue(v.Field(idx)))
+			}
+		}
+		return rv
+
+	default:
+		return v
+	}
+}
+
+func copyElements(dst, src reflect.Value) {
+	switch src.Type().Elem().Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		for idx := 0; idx < src.Len(); idx++ {
+			dst.Index(idx).Set(copyValue(src.Index(idx)))
+		}
+	default:
+		reflect.Copy(dst, src)
+	}
+}
@@ -0,0 +1,292 @@
+package platformsh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// DotEnvSyntaxError describes a malformed line in a dotenv file.
+type DotEnvSyntaxError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e DotEnvSyntaxError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ParseDotEnv parses the dotenv formatted data from r. Blank lines and lines
+// starting with # are ignored and keys may be prefixed with `export`. Values
+// may be unquoted, single quoted (literal) or double quoted (escapes and
+// interpolation). Quoted values may span multiple lines. ${VAR} and $VAR are
+// expanded in unquoted and double quoted values from the values read so far,
+// then from lookup.
+func ParseDotEnv(r io.Reader, lookup LookupFunc) (map[string]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := dotEnvParser{
+		src:    []rune(string(data)),
+		line:   1,
+		lookup: lookup,
+		values: make(map[string]string),
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.values, nil
+}
+
+type dotEnvParser struct {
+	src    []rune
+	pos    int
+	line   int
+	lookup LookupFunc
+	values map[string]string
+}
+
+func (p *dotEnvParser) errorf(format string, args ...interface{}) error {
+	return DotEnvSyntaxError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *dotEnvParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *dotEnvParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *dotEnvParser) next() rune {
+	r := p.peek()
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *dotEnvParser) skipBlank() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *dotEnvParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *dotEnvParser) parse() error {
+	for !p.eof() {
+		p.skipBlank()
+		switch p.peek() {
+		case 0:
+			return nil
+		case '\n', '\r':
+			p.next()
+			continue
+		case '#':
+			p.skipLine()
+			continue
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return err
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		p.values[key] = value
+	}
+	return nil
+}
+
+func (p *dotEnvParser) ident() string {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		p.next()
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *dotEnvParser) key() (string, error) {
+	key := p.ident()
+	if key == "export" && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipBlank()
+		key = p.ident()
+	}
+	if key == "" {
+		return "", p.errorf("expected variable name, found %q", p.peek())
+	}
+
+	p.skipBlank()
+	if p.peek() != '=' {
+		return "", p.errorf("expected '=' after %s", key)
+	}
+	p.next()
+	p.skipBlank()
+	return key, nil
+}
+
+func (p *dotEnvParser) value() (string, error) {
+	var value string
+	var err error
+
+	switch p.peek() {
+	case '\'':
+		value, err = p.singleQuoted()
+	case '"':
+		value, err = p.doubleQuoted()
+	default:
+		return p.unquoted()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// only a comment may follow a quoted value
+	p.skipBlank()
+	switch p.peek() {
+	case 0, '\n':
+		p.next()
+	case '\r':
+		p.next()
+		if p.peek() == '\n' {
+			p.next()
+		}
+	case '#':
+		p.skipLine()
+	default:
+		return "", p.errorf("unexpected %q after quoted value", p.peek())
+	}
+	return value, nil
+}
+
+func (p *dotEnvParser) singleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", DotEnvSyntaxError{Line: line, Msg: "unterminated single quoted value"}
+		}
+		r := p.next()
+		if r == '\'' {
+			return sb.String(), nil
+		}
+		sb.WriteRune(r)
+	}
+}
+
+func (p *dotEnvParser) doubleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", DotEnvSyntaxError{Line: line, Msg: "unterminated double quoted value"}
+		}
+		r := p.next()
+		switch r {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", DotEnvSyntaxError{Line: line, Msg: "unterminated double quoted value"}
+			}
+			switch e := p.next(); e {
+			case 'n':
+				sb.WriteRune('\n')
+			case 'r':
+				sb.WriteRune('\r')
+			case 't':
+				sb.WriteRune('\t')
+			case '"', '\\', '$', '\'':
+				sb.WriteRune(e)
+			case '\n':
+				// line continuation
+			default:
+				return "", p.errorf("invalid escape sequence \\%c", e)
+			}
+		case '$':
+			if err := p.interpolate(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+}
+
+func (p *dotEnvParser) unquoted() (string, error) {
+	var sb strings.Builder
+	for !p.eof() {
+		r := p.peek()
+		if r == '\n' || r == '\r' {
+			break
+		}
+		if r == '#' && (sb.Len() == 0 || strings.HasSuffix(sb.String(), " ") || strings.HasSuffix(sb.String(), "\t")) {
+			break
+		}
+		p.next()
+		if r == '$' {
+			if err := p.interpolate(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	p.skipLine()
+	return strings.TrimRightFunc(sb.String(), unicode.IsSpace), nil
+}
+
+// interpolate expands the variable reference following a `$`.
+func (p *dotEnvParser) interpolate(sb *strings.Builder) error {
+	var name string
+	if p.peek() == '{' {
+		p.next()
+		name = p.ident()
+		if p.peek() != '}' {
+			return p.errorf("unterminated variable reference ${%s", name)
+		}
+		p.next()
+		if name == "" {
+			return p.errorf("empty variable reference")
+		}
+	} else {
+		name = p.ident()
+		if name == "" {
+			sb.WriteRune('$')
+			return nil
+		}
+	}
+
+	if v, ok := p.values[name]; ok {
+		sb.WriteString(v)
+	} else if p.lookup != nil {
+		v, _ := p.lookup(name)
+		sb.WriteString(v)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package platformsh_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "HOME" {
+			return "/app", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "empty",
+			data: "",
+			want: map[string]string{},
+		},
+		{
+			name: "simple",
+			data: "A=1\nB = 2 \n\n  C=three four\n",
+			want: map[string]string{"A": "1", "B": "2", "C": "three four"},
+		},
+		{
+			name: "comments",
+			data: "# comment\nA=1 # trailing\nB=a#b\n  # indented\n",
+			want: map[string]string{"A": "1", "B": "a#b"},
+		},
+		{
+			name: "export",
+			data: "export A=1\nexport=2\n",
+			want: map[string]string{"A": "1", "export": "2"},
+		},
+		{
+			name: "single quoted",
+			data: "A='$HOME \\n # not a comment'\n",
+			want: map[string]string{"A": "$HOME \\n # not a comment"},
+		},
+		{
+			name: "double quoted",
+			data: `A="tab\there \"quoted\" \$HOME" # comment` + "\n",
+			want: map[string]string{"A": "tab\there \"quoted\" $HOME"},
+		},
+		{
+			name: "multi-line",
+			data: "CERT=\"-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\"\nB='x\ny'\nC=3\n",
+			want: map[string]string{
+				"CERT": "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----",
+				"B":    "x\ny",
+				"C":    "3",
+			},
+		},
+		{
+			name: "escaped newlines",
+			data: `A="line1\nline2"`,
+			want: map[string]string{"A": "line1\nline2"},
+		},
+		{
+			name: "interpolation",
+			data: "A=one\nB=${A}-$A-${HOME}/$MISSING.\nC=\"$B\"\nD=$\n",
+			want: map[string]string{"A": "one", "B": "one-one-/app/.", "C": "one-one-/app/.", "D": "$"},
+		},
+		{
+			name: "crlf",
+			data: "A=1\r\nB=\"2\"\r\nC=3",
+			want: map[string]string{"A": "1", "B": "2", "C": "3"},
+		},
+		{
+			name:    "missing equals",
+			data:    "A=1\nB\n",
+			wantErr: "line 2: expected '=' after B",
+		},
+		{
+			name:    "bad key",
+			data:    "A=1\n\n=2\n",
+			wantErr: "line 3: expected variable name",
+		},
+		{
+			name:    "unterminated",
+			data:    "A=1\nB=\"abc\n\ndef\n",
+			wantErr: "line 2: unterminated double quoted value",
+		},
+		{
+			name:    "unterminated single",
+			data:    "A='abc",
+			wantErr: "line 1: unterminated single quoted value",
+		},
+		{
+			name:    "trailing garbage",
+			data:    "A=1\nB='x' y\n",
+			wantErr: "line 2: unexpected",
+		},
+		{
+			name:    "bad escape",
+			data:    `A="\q"`,
+			wantErr: `line 1: invalid escape sequence \q`,
+		},
+		{
+			name:    "unterminated reference",
+			data:    "A=${B",
+			wantErr: "line 1: unterminated variable reference",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotEnv(strings.NewReader(tt.data), lookup)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEnvironment_DotEnvFiles(t *testing.T) {
+	vars := map[string]string{"PLATFORM_DIR": "/app"}
+	env, fs := newTestEnvironment(t, "PLATFORM_PROJECT=one\nPLATFORM_BRANCH=master\n", vars)
+	require.NoError(t, afero.WriteFile(fs, "/.env.local", []byte("PLATFORM_BRANCH=${PLATFORM_PROJECT}-local\nPLATFORM_APP_DIR=$PLATFORM_DIR/src\n"), 0644))
+
+	project, err := env.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "one", project)
+
+	branch, err := env.Branch()
+	require.NoError(t, err)
+	assert.Equal(t, "one-local", branch)
+
+	dir, err := env.AppDir()
+	require.NoError(t, err)
+	assert.Equal(t, "/app/src", dir)
+}
+
+func TestEnvironment_DotEnvSyntaxError(t *testing.T) {
+	env, fs := newTestEnvironment(t, "PLATFORM_PROJECT=one\n", nil)
+	require.NoError(t, afero.WriteFile(fs, "/.env.local", []byte("PLATFORM_BRANCH=\"oops\n"), 0644))
+
+	// a broken file is skipped without discarding the others
+	project, err := env.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "one", project)
+
+	_, err = env.Branch()
+	assert.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "", Redact(""))
+	assert.Equal(t, "[REDACTED 6 bytes]", Redact("secret"))
+}
@@ -1,11 +1,12 @@
 package platformsh
 
 import (
-	"bufio"
+	"context"
+	"fmt"
 	"net"
 	"os"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
@@ -20,17 +21,29 @@ type Environment interface {
 	SetFileSystem(afero.Fs)
 
 	SetLookupFunc(LookupFunc)
+	SetSources(...VariableSource)
+	Sources() VariableSources
+	DotEnv() VariableSource
 	Lookup(string) (string, bool)
+	Which(string) (VariableSource, bool)
 
 	ReadDotEnv()
+	Reload()
+	Watch(ctx context.Context, interval time.Duration)
+	Subscribe(name string, fn ChangeFunc)
 
 	Listener() (net.Listener, error)
+	SystemdListeners() ([]NamedListener, error)
 
 	Variable(key string) (interface{}, bool)
 }
 
 type LookupFunc func(string) (string, bool)
 
+// ChangeFunc is called when a subscribed variable changes. ok is false when
+// the variable is no longer set.
+type ChangeFunc func(name, value string, ok bool)
+
 type environment struct {
 	prefix string
 
@@ -39,9 +52,40 @@ type environment struct {
 
 	lookupMu sync.Mutex
 	lookup   LookupFunc
+	sources  VariableSources
+
+	dotEnvMu   sync.Mutex
+	dotEnv     map[string]string
+	dotEnvStat dotEnvStat
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedValue
+
+	subscribersMu sync.Mutex
+	subscribers   map[string]*subscription
+}
+
+// DotEnvFiles are read in order, relative to the environment file system.
+// Values in later files override values in earlier files.
+var DotEnvFiles = [...]string{"/.env", "/.env.local"}
+
+type dotEnvStat [len(DotEnvFiles)]fileStat
+
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+type cachedValue struct {
+	raw   string
+	value interface{}
+}
 
-	readDotEnvOnce sync.Once
-	dotEnv         map[string]string
+type subscription struct {
+	value string
+	ok    bool
+	fns   []ChangeFunc
 }
 
 func DefaultFileSystem(cwd string) afero.Fs {
@@ -84,47 +128,261 @@ func (e *environment) SetFileSystem(fs afero.Fs) {
 }
 
 func (e *environment) ReadDotEnv() {
-	e.readDotEnvOnce.Do(e.reallyReadDotEnv)
+	e.dotEnvMu.Lock()
+	if e.dotEnv == nil {
+		e.dotEnv, e.dotEnvStat = e.reallyReadDotEnv()
+	}
+	e.dotEnvMu.Unlock()
+}
+
+// Reload re-reads the dotenv files and any sources that cache their values,
+// then notifies subscribers of any changed variables.
+func (e *environment) Reload() {
+	dotEnv, stat := e.reallyReadDotEnv()
+	e.dotEnvMu.Lock()
+	e.dotEnv, e.dotEnvStat = dotEnv, stat
+	e.dotEnvMu.Unlock()
+
+	for _, src := range e.Sources() {
+		if r, ok := src.(Reloader); ok {
+			if err := r.Reload(); err != nil {
+				logrus.WithError(err).WithField("source", src.Name()).Error("unable to reload source")
+			}
+		}
+	}
+
+	e.notify()
 }
 
-func (e *environment) reallyReadDotEnv() {
+// Watch polls the sources every interval until the context is done,
+// reloading files when they change and notifying subscribers.
+func (e *environment) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.dotEnvMu.Lock()
+			previous := e.dotEnvStat
+			e.dotEnvMu.Unlock()
+
+			if e.statDotEnv() != previous || e.sourcesChanged() {
+				logrus.Debug("sources changed; reloading")
+				e.Reload()
+			} else {
+				e.notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *environment) sourcesChanged() bool {
+	for _, src := range e.Sources() {
+		if r, ok := src.(Reloader); ok && r.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *environment) statDotEnv() dotEnvStat {
+	var rv dotEnvStat
 	fs := e.FileSystem()
-	fp, err := fs.Open("/.env")
-	if os.IsNotExist(err) {
-		logrus.Debug("no .env file found")
-		return
-	}
-	e.dotEnv = make(map[string]string)
-	scanner := bufio.NewScanner(fp)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if idx := strings.Index(line, "="); idx > 0 {
-			k := line[:idx]
-			v := line[idx+1:]
+	for idx, name := range DotEnvFiles {
+		rv[idx] = statFile(fs, name)
+	}
+	return rv
+}
+
+func (e *environment) reallyReadDotEnv() (map[string]string, dotEnvStat) {
+	rv := make(map[string]string)
+	stat := e.statDotEnv()
+
+	// later files may reference values from earlier files, and every file
+	// the values of the other sources, wherever the dotenv files rank
+	others := e.otherSources()
+	lookup := func(name string) (string, bool) {
+		if v, ok := rv[name]; ok {
+			return v, true
+		}
+		return others.Lookup(name)
+	}
+
+	for _, name := range DotEnvFiles {
+		values, err := e.readDotEnvFile(name, lookup)
+		if err != nil {
+			logrus.WithError(err).Errorf("unable to read %s", name)
+			continue
+		}
+
+		for k, v := range values {
 			logrus.WithFields(logrus.Fields{
 				"key":   k,
-				"value": v,
-			}).Infof("read %s from .env", k)
-			e.dotEnv[k] = v
+				"value": Redact(v),
+			}).Debugf("read %s from %s", k, name)
+			rv[k] = v
 		}
 	}
-	_ = fp.Close()
+
+	return rv, stat
 }
 
-func (e *environment) Lookup(name string) (string, bool) {
-	e.ReadDotEnv()
-	if v, ok := e.dotEnv[name]; ok {
-		return v, true
+func (e *environment) readDotEnvFile(name string, lookup LookupFunc) (map[string]string, error) {
+	fp, err := e.FileSystem().Open(name)
+	if os.IsNotExist(err) {
+		logrus.Debugf("no %s file found", name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	values, err := ParseDotEnv(fp, lookup)
+	if serr, ok := err.(DotEnvSyntaxError); ok {
+		serr.File = name
+		return nil, serr
+	}
+	return values, err
+}
+
+// otherSources are the sources besides the dotenv files.
+func (e *environment) otherSources() VariableSources {
+	sources := e.Sources()
+	rv := make(VariableSources, 0, len(sources))
+	for _, src := range sources {
+		if _, ok := src.(dotEnvSource); !ok {
+			rv = append(rv, src)
+		}
 	}
+	return rv
+}
 
+// Sources returns the sources in order of precedence. Unless SetSources is
+// called, these are the dotenv files followed by the lookup function.
+func (e *environment) Sources() VariableSources {
 	e.lookupMu.Lock()
-	fn := e.lookup
+	sources, fn := e.sources, e.lookup
 	e.lookupMu.Unlock()
 
+	if sources != nil {
+		return sources
+	}
 	if fn == nil {
-		fn = os.LookupEnv
+		return VariableSources{e.DotEnv(), ProcessEnv()}
 	}
-	return fn(name)
+	return VariableSources{e.DotEnv(), FuncSource("lookup", fn)}
+}
+
+// SetSources replaces the sources consulted by Lookup. Use DotEnv to include
+// the dotenv files; they are re-read as their references may now resolve
+// differently.
+func (e *environment) SetSources(sources ...VariableSource) {
+	e.lookupMu.Lock()
+	e.sources = VariableSources(sources)
+	e.lookupMu.Unlock()
+
+	e.dotEnvMu.Lock()
+	e.dotEnv = nil
+	e.dotEnvMu.Unlock()
+}
+
+// DotEnv returns the source backed by the environment's dotenv files.
+func (e *environment) DotEnv() VariableSource {
+	return dotEnvSource{e}
+}
+
+func (e *environment) Lookup(name string) (string, bool) {
+	return e.Sources().Lookup(name)
+}
+
+// Which returns the source that supplies name, for debugging.
+func (e *environment) Which(name string) (VariableSource, bool) {
+	return e.Sources().Which(name)
+}
+
+// Subscribe registers fn to be called when the variable changes. Changes are
+// detected by Reload and Watch.
+func (e *environment) Subscribe(name string, fn ChangeFunc) {
+	value, ok := e.Lookup(name)
+
+	e.subscribersMu.Lock()
+	defer e.subscribersMu.Unlock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[string]*subscription)
+	}
+
+	sub, exists := e.subscribers[name]
+	if !exists {
+		sub = &subscription{value: value, ok: ok}
+		e.subscribers[name] = sub
+	}
+	sub.fns = append(sub.fns, fn)
+}
+
+func (e *environment) notify() {
+	type change struct {
+		name  string
+		value string
+		ok    bool
+		fns   []ChangeFunc
+	}
+
+	e.subscribersMu.Lock()
+	names := make([]string, 0, len(e.subscribers))
+	for name := range e.subscribers {
+		names = append(names, name)
+	}
+	e.subscribersMu.Unlock()
+
+	var changes []change
+	for _, name := range names {
+		value, ok := e.Lookup(name)
+
+		e.subscribersMu.Lock()
+		sub := e.subscribers[name]
+		if sub.value != value || sub.ok != ok {
+			sub.value, sub.ok = value, ok
+			fns := make([]ChangeFunc, len(sub.fns))
+			copy(fns, sub.fns)
+			changes = append(changes, change{name, value, ok, fns})
+		}
+		e.subscribersMu.Unlock()
+	}
+
+	for _, c := range changes {
+		logrus.WithField("name", c.name).Debug("environment variable changed")
+		for _, fn := range c.fns {
+			fn(c.name, c.value, c.ok)
+		}
+	}
+}
+
+// cached returns a copy of the decoded value memoized for name as long as
+// the raw value has not changed since it was decoded. Every caller gets its
+// own copy, so they may modify it.
+func (e *environment) cached(name, raw string) (interface{}, bool) {
+	e.cacheMu.Lock()
+	v, ok := e.cache[name]
+	e.cacheMu.Unlock()
+	if ok && v.raw == raw {
+		return deepCopy(v.value), true
+	}
+	return nil, false
+}
+
+// setCached keeps a copy of value; the caller's value is returned as is.
+func (e *environment) setCached(name, raw string, value interface{}) {
+	value = deepCopy(value)
+
+	e.cacheMu.Lock()
+	defer e.cacheMu.Unlock()
+	if e.cache == nil {
+		e.cache = make(map[string]cachedValue)
+	}
+	e.cache[name] = cachedValue{raw: raw, value: value}
 }
 
 func (e *environment) SetLookupFunc(fn LookupFunc) {
@@ -166,3 +424,11 @@ func (e *environment) Variable(key string) (interface{}, bool) {
 	v, ok := vars[key]
 	return v, ok
 }
+
+// Redact hides a value that may be a secret so it can be logged.
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("[REDACTED %d bytes]", len(value))
+}
@@ -42,17 +42,22 @@ func (e *environment) Application() (*Application, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(*Application), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := Application{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, &obj)
 	return &obj, nil
 }
 
@@ -183,17 +188,22 @@ func (e *environment) Relationships() (Relationships, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(Relationships), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := Relationships{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, obj)
 	return obj, nil
 }
 
@@ -204,17 +214,22 @@ func (e *environment) Routes() (Routes, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(Routes), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := Routes{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, obj)
 	return obj, nil
 }
 
@@ -255,17 +270,22 @@ func (e *environment) Variables() (JSONObject, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(JSONObject), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := JSONObject{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, obj)
 	return obj, nil
 }
 
@@ -276,17 +296,22 @@ func (e *environment) Vars() (JSONObject, error) {
 		return nil, missingEnvironment(name)
 	}
 
+	if cached, ok := e.cached(name, value); ok {
+		return cached.(JSONObject), nil
+	}
+
 	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
 	obj := JSONObject{}
 	err = json.Unmarshal(data, &obj)
 	if err != nil {
-		return nil, MissingEnvironment{name, err}
+		return nil, DecodeError{name, err}
 	}
 
+	e.setCached(name, value, obj)
 	return obj, nil
 }
 
@@ -339,3 +364,173 @@ func (e *environment) XClientVerify() (string, error) {
 
 	return value, nil
 }
+
+// WellKnownVariables describes the variables behind EnvironmentAPI.
+var WellKnownVariables = []WellKnownVariable{
+	{
+		Decoded: true,
+		EnvName: "APPLICATION",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Application()
+		},
+		Name: "Application",
+	},
+	{
+		EnvName: "APPLICATION_NAME",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.ApplicationName()
+		},
+		Name: "ApplicationName",
+	},
+	{
+		EnvName: "APP_COMMAND",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.AppCommand()
+		},
+		Name: "AppCommand",
+	},
+	{
+		EnvName: "APP_DIR",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.AppDir()
+		},
+		Name: "AppDir",
+	},
+	{
+		EnvName: "BRANCH",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Branch()
+		},
+		Name: "Branch",
+	},
+	{
+		EnvName: "DIR",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Dir()
+		},
+		Name: "Dir",
+	},
+	{
+		EnvName: "DOCUMENT_ROOT",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.DocumentRoot()
+		},
+		Name: "DocumentRoot",
+	},
+	{
+		EnvName: "ENVIRONMENT",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Environment()
+		},
+		Name: "Environment",
+	},
+	{
+		EnvName: "PORT",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Port()
+		},
+		Name:     "Port",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "PROJECT",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Project()
+		},
+		Name: "Project",
+	},
+	{
+		EnvName: "PROJECT_ENTROPY",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.ProjectEntropy()
+		},
+		Name:   "ProjectEntropy",
+		Secret: true,
+	},
+	{
+		Decoded: true,
+		EnvName: "RELATIONSHIPS",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Relationships()
+		},
+		Name: "Relationships",
+	},
+	{
+		Decoded: true,
+		EnvName: "ROUTES",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Routes()
+		},
+		Name: "Routes",
+	},
+	{
+		EnvName: "SMTP_HOST",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.SMTPHost()
+		},
+		Name: "SMTPHost",
+	},
+	{
+		EnvName: "SOCKET",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Socket()
+		},
+		Name:     "Socket",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "TREE_ID",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.TreeID()
+		},
+		Name: "TreeID",
+	},
+	{
+		Decoded: true,
+		EnvName: "VARIABLES",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.Variables()
+		},
+		Name: "Variables",
+	},
+	{
+		EnvName: "X_CLIENT_CERT",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.XClientCert()
+		},
+		Name:     "XClientCert",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "X_CLIENT_DN",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.XClientDN()
+		},
+		Name:     "XClientDN",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "X_CLIENT_IP",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.XClientIP()
+		},
+		Name:     "XClientIP",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "X_CLIENT_SSL",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.XClientSSL()
+		},
+		Name:     "XClientSSL",
+		NoPrefix: true,
+	},
+	{
+		EnvName: "X_CLIENT_VERIFY",
+		Get: func(e EnvironmentAPI) (interface{}, error) {
+			return e.XClientVerify()
+		},
+		Name:     "XClientVerify",
+		NoPrefix: true,
+	},
+}
@@ -0,0 +1,156 @@
+package platformsh_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func newTestEnvironment(t *testing.T, dotEnv string, vars map[string]string) (Environment, afero.Fs) {
+	fs := afero.NewMemMapFs()
+	if dotEnv != "" {
+		require.NoError(t, afero.WriteFile(fs, "/.env", []byte(dotEnv), 0644))
+	}
+
+	env := NewEnvironment("PLATFORM_")
+	env.SetFileSystem(fs)
+	env.SetLookupFunc(func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	})
+	return env, fs
+}
+
+func TestEnvironment_Reload(t *testing.T) {
+	env, fs := newTestEnvironment(t, "PLATFORM_PROJECT=one\n", nil)
+
+	var changes []string
+	env.Subscribe("PLATFORM_PROJECT", func(name, value string, ok bool) {
+		assert.Equal(t, "PLATFORM_PROJECT", name)
+		if ok {
+			changes = append(changes, value)
+		} else {
+			changes = append(changes, "<unset>")
+		}
+	})
+
+	v, err := env.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "one", v)
+
+	env.Reload()
+	assert.Empty(t, changes)
+
+	require.NoError(t, afero.WriteFile(fs, "/.env", []byte("PLATFORM_PROJECT=two\n"), 0644))
+	env.Reload()
+	assert.Equal(t, []string{"two"}, changes)
+
+	v, err = env.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "two", v)
+
+	require.NoError(t, fs.Remove("/.env"))
+	env.Reload()
+	assert.Equal(t, []string{"two", "<unset>"}, changes)
+}
+
+func TestEnvironment_Watch(t *testing.T) {
+	vars := map[string]string{"PLATFORM_BRANCH": "master"}
+	var mu sync.Mutex
+	env := NewEnvironment("PLATFORM_")
+	env.SetFileSystem(afero.NewMemMapFs())
+	env.SetLookupFunc(func(name string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		v, ok := vars[name]
+		return v, ok
+	})
+
+	changed := make(chan string, 1)
+	env.Subscribe("PLATFORM_BRANCH", func(_, value string, _ bool) {
+		changed <- value
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go env.Watch(ctx, time.Millisecond)
+
+	mu.Lock()
+	vars["PLATFORM_BRANCH"] = "feature"
+	mu.Unlock()
+
+	select {
+	case v := <-changed:
+		assert.Equal(t, "feature", v)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change notification")
+	}
+}
+
+func TestEnvironment_Memoize(t *testing.T) {
+	vars := map[string]string{
+		"PLATFORM_VARIABLES": "eyJmb28iOiAiYmFyIn0=", // {"foo": "bar"}
+	}
+	env, _ := newTestEnvironment(t, "", vars)
+
+	first, err := env.Variables()
+	require.NoError(t, err)
+	second, err := env.Variables()
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	// every caller gets its own copy
+	assert.NotEqual(t, reflect.ValueOf(first).Pointer(), reflect.ValueOf(second).Pointer())
+	first["foo"] = "modified"
+	second, err = env.Variables()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", second["foo"])
+
+	vars["PLATFORM_VARIABLES"] = "eyJmb28iOiAiYmF6In0=" // {"foo": "baz"}
+	third, err := env.Variables()
+	require.NoError(t, err)
+	assert.Equal(t, "baz", third["foo"])
+}
+
+func TestEnvironment_MemoizeCopies(t *testing.T) {
+	vars := map[string]string{
+		"PLATFORM_RELATIONSHIPS": encodeJSON(`{"database": [{"host": "db.internal", "query": {"is_master": true}}]}`),
+		"PLATFORM_ROUTES":        encodeJSON(`{"https://example.com/": {"type": "upstream", "id": "main", "http_access": {"basic_auth": {"admin": "s3cret"}}}}`),
+	}
+	env, _ := newTestEnvironment(t, "", vars)
+
+	rels, err := env.Relationships()
+	require.NoError(t, err)
+	rels["database"][0].Host = "modified"
+	rels["database"][0].Query["is_master"] = false
+	delete(rels, "database")
+
+	rels, err = env.Relationships()
+	require.NoError(t, err)
+	require.Len(t, rels["database"], 1)
+	assert.Equal(t, "db.internal", rels["database"][0].Host)
+	assert.Equal(t, true, rels["database"][0].Query["is_master"])
+
+	routes, err := env.Routes()
+	require.NoError(t, err)
+	for u, route := range routes {
+		*route.ID = "modified"
+		route.HTTPAccess.BasicAuth["admin"] = "modified"
+		routes[u] = route
+	}
+
+	routes, err = env.Routes()
+	require.NoError(t, err)
+	for _, route := range routes {
+		assert.Equal(t, "main", *route.ID)
+		assert.Equal(t, "s3cret", route.HTTPAccess.BasicAuth["admin"])
+	}
+}
@@ -1,6 +1,7 @@
 package platformsh
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -21,14 +22,39 @@ func (e AggregateError) Append(errors ...error) AggregateError {
 }
 
 func (e AggregateError) Error() string {
-	errors := make([]string, len(e))
+	msgs := make([]string, len(e))
 	for idx, err := range e {
-		errors[idx] = err.Error()
+		msgs[idx] = err.Error()
 	}
 
-	return strings.Join(errors, ", ")
+	return strings.Join(msgs, ", ")
 }
 
+func (e AggregateError) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the errors matches target.
+func (e AggregateError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target.
+func (e AggregateError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingEnvironment is returned when a variable is not set.
 type MissingEnvironment struct {
 	Name       string
 	InnerError error
@@ -42,6 +68,38 @@ func (e MissingEnvironment) Error() string {
 	return s
 }
 
+func (e MissingEnvironment) Unwrap() error {
+	return e.InnerError
+}
+
+// Is matches a MissingEnvironment target with the same name, or any name if
+// the target name is empty.
+func (e MissingEnvironment) Is(target error) bool {
+	t, ok := target.(MissingEnvironment)
+	return ok && (t.Name == "" || t.Name == e.Name)
+}
+
+// DecodeError is returned when a variable is set but cannot be decoded.
+type DecodeError struct {
+	Name       string
+	InnerError error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("unable to decode %s: %v", e.Name, e.InnerError)
+}
+
+func (e DecodeError) Unwrap() error {
+	return e.InnerError
+}
+
+// Is matches a DecodeError target with the same name, or any name if the
+// target name is empty.
+func (e DecodeError) Is(target error) bool {
+	t, ok := target.(DecodeError)
+	return ok && (t.Name == "" || t.Name == e.Name)
+}
+
 func missingEnvironment(names ...string) error {
 	if len(names) == 0 {
 		return nil
@@ -0,0 +1,67 @@
+package platformsh_test
+
+import (
+	"errors"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func TestErrors_IsAs(t *testing.T) {
+	inner := errors.New("illegal base64 data")
+	decode := DecodeError{Name: "PLATFORM_ROUTES", InnerError: inner}
+	missing := MissingEnvironment{Name: "SOCKET"}
+	agg := AggregateError{}.Append(missing, pkgerrors.Wrap(decode, "context"))
+
+	tests := []struct {
+		name        string
+		err         error
+		wantMissing bool
+		wantDecode  bool
+	}{
+		{"missing", missing, true, false},
+		{"decode", decode, false, true},
+		{"wrapped decode", pkgerrors.Wrap(decode, "wrapped"), false, true},
+		{"aggregate", agg, true, true},
+		{"nested aggregate", AggregateError{pkgerrors.Wrap(AggregateError{missing}, "wrapped")}, true, false},
+		{"other", inner, false, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var m MissingEnvironment
+			assert.Equal(t, tt.wantMissing, errors.As(tt.err, &m))
+			assert.Equal(t, tt.wantMissing, errors.Is(tt.err, MissingEnvironment{}))
+
+			var d DecodeError
+			assert.Equal(t, tt.wantDecode, errors.As(tt.err, &d))
+			assert.Equal(t, tt.wantDecode, errors.Is(tt.err, DecodeError{}))
+			if tt.wantDecode {
+				assert.Equal(t, "PLATFORM_ROUTES", d.Name)
+				assert.True(t, errors.Is(tt.err, inner))
+			}
+		})
+	}
+
+	assert.True(t, errors.Is(agg, MissingEnvironment{Name: "SOCKET"}))
+	assert.False(t, errors.Is(agg, MissingEnvironment{Name: "PORT"}))
+	assert.True(t, errors.Is(agg, DecodeError{Name: "PLATFORM_ROUTES"}))
+	assert.Equal(t, "unable to decode PLATFORM_ROUTES: illegal base64 data", decode.Error())
+	assert.Equal(t, "no environment variable found for SOCKET, context: unable to decode PLATFORM_ROUTES: illegal base64 data", agg.Error())
+}
+
+func TestEnvironment_DecodeError(t *testing.T) {
+	env, _ := newTestEnvironment(t, "", map[string]string{"PLATFORM_ROUTES": "not base64"})
+
+	_, err := env.Routes()
+	assert.True(t, errors.As(err, new(DecodeError)))
+	assert.False(t, errors.As(err, new(MissingEnvironment)))
+
+	_, err = env.Relationships()
+	assert.False(t, errors.As(err, new(DecodeError)))
+	assert.True(t, errors.As(err, new(MissingEnvironment)))
+}
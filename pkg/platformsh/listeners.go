@@ -0,0 +1,155 @@
+package platformsh
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ListenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const ListenFDsStart = 3
+
+// ListenAddress describes where a server listens.
+//
+//	tcp://127.0.0.1:8080, 127.0.0.1:8080, [::1]:8080, :8080, 8080
+//	tls://0.0.0.0:8443
+//	unix:///run/app.sock, /run/app.sock
+//
+// A bare port listens on 127.0.0.1, same as PORT.
+type ListenAddress struct {
+	Network string
+	Address string
+	TLS     bool
+}
+
+func ParseListenAddress(s string) (ListenAddress, error) {
+	logrus.Trace("ParseListenAddress")
+
+	rv := ListenAddress{Network: "tcp"}
+	if idx := strings.Index(s, "://"); idx >= 0 {
+		switch scheme := s[:idx]; scheme {
+		case "tcp", "tcp4", "tcp6", "unix":
+			rv.Network = scheme
+		case "tls", "https":
+			rv.TLS = true
+		default:
+			return rv, errors.Errorf("unknown listen scheme %q in %q", scheme, s)
+		}
+		s = s[idx+3:]
+	} else if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "./") {
+		rv.Network = "unix"
+	}
+
+	if s == "" {
+		return rv, errors.New("empty listen address")
+	}
+
+	if rv.Network == "unix" {
+		rv.Address = s
+		return rv, nil
+	}
+
+	if _, err := strconv.ParseUint(s, 10, 16); err == nil {
+		s = "127.0.0.1:" + s
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return rv, errors.Wrapf(err, "invalid listen address %q", s)
+	}
+	rv.Address = net.JoinHostPort(host, port)
+	return rv, nil
+}
+
+func (a ListenAddress) String() string {
+	scheme := a.Network
+	if a.TLS {
+		scheme = "tls"
+	}
+	return scheme + "://" + a.Address
+}
+
+// Listen opens the address. config is required for TLS addresses.
+func (a ListenAddress) Listen(config *tls.Config) (net.Listener, error) {
+	logrus.WithField("address", a).Trace("ListenAddress.Listen")
+
+	if a.TLS && config == nil {
+		return nil, errors.Errorf("%v requires a TLS configuration", a)
+	}
+
+	l, err := net.Listen(a.Network, a.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.TLS {
+		return tls.NewListener(l, config), nil
+	}
+	return l, nil
+}
+
+// NamedListener is a socket passed by systemd; Name is from LISTEN_FDNAMES.
+type NamedListener struct {
+	net.Listener
+	Name string
+}
+
+// SystemdListeners returns the sockets passed by systemd socket activation,
+// or nil when the process was not socket activated. A process can't know its
+// child's pid before exec, so a parent handing over its sockets sets
+// LISTEN_PPID to its own pid instead of LISTEN_PID.
+func (e *environment) SystemdListeners() ([]NamedListener, error) {
+	logrus.Trace("SystemdListeners")
+
+	pid, _ := e.Lookup("LISTEN_PID")
+	ppid, _ := e.Lookup("LISTEN_PPID")
+	if pid != strconv.Itoa(os.Getpid()) && ppid != strconv.Itoa(os.Getppid()) {
+		return nil, nil
+	}
+
+	fds, ok := e.Lookup("LISTEN_FDS")
+	if !ok {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, errors.Errorf("invalid LISTEN_FDS=%q", fds)
+	}
+
+	var names []string
+	if v, ok := e.Lookup("LISTEN_FDNAMES"); ok && v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	rv := make([]NamedListener, 0, count)
+	for idx := 0; idx < count; idx++ {
+		fd := ListenFDsStart + idx
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if idx < len(names) {
+			name = names[idx]
+		}
+
+		fp := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(fp)
+		// FileListener dups the descriptor
+		_ = fp.Close()
+		if err != nil {
+			for _, l := range rv {
+				_ = l.Close()
+			}
+			return nil, errors.Wrapf(err, "unable to use file descriptor %d (%s)", fd, name)
+		}
+
+		logrus.WithField("fd", fd).WithField("name", name).WithField("addr", l.Addr()).Debug("found systemd listener")
+		rv = append(rv, NamedListener{Listener: l, Name: name})
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,106 @@
+package platformsh_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    ListenAddress
+		wantErr bool
+	}{
+		{"8080", ListenAddress{"tcp", "127.0.0.1:8080", false}, false},
+		{":8080", ListenAddress{"tcp", ":8080", false}, false},
+		{"0.0.0.0:80", ListenAddress{"tcp", "0.0.0.0:80", false}, false},
+		{"[::1]:8080", ListenAddress{"tcp", "[::1]:8080", false}, false},
+		{"tcp6://[::]:8080", ListenAddress{"tcp6", "[::]:8080", false}, false},
+		{"tls://:8443", ListenAddress{"tcp", ":8443", true}, false},
+		{"https://[::1]:8443", ListenAddress{"tcp", "[::1]:8443", true}, false},
+		{"unix:///run/app.sock", ListenAddress{"unix", "/run/app.sock", false}, false},
+		{"/run/app.sock", ListenAddress{"unix", "/run/app.sock", false}, false},
+		{"", ListenAddress{}, true},
+		{"tcp://", ListenAddress{}, true},
+		{"udp://:53", ListenAddress{}, true},
+		{"::1", ListenAddress{}, true},
+		{"localhost", ListenAddress{}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := ParseListenAddress(tt.addr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := ParseListenAddress(got.String())
+			require.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+}
+
+func TestListenAddress_Listen(t *testing.T) {
+	l, err := ListenAddress{Network: "tcp", Address: "127.0.0.1:0"}.Listen(nil)
+	require.NoError(t, err)
+	assert.NoError(t, l.Close())
+
+	_, err = ListenAddress{Network: "tcp", Address: "127.0.0.1:0", TLS: true}.Listen(nil)
+	assert.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "listeners")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err = ListenAddress{Network: "unix", Address: filepath.Join(dir, "app.sock")}.Listen(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "unix", l.Addr().Network())
+	assert.NoError(t, l.Close())
+}
+
+func TestEnvironment_SystemdListeners(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	ppid := strconv.Itoa(os.Getppid())
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantErr bool
+	}{
+		{"not activated", map[string]string{}, false},
+		{"other process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}, false},
+		{"other parent", map[string]string{"LISTEN_PPID": "1", "LISTEN_FDS": "1"}, false},
+		{"no sockets", map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "0"}, false},
+		{"restarted", map[string]string{"LISTEN_PPID": ppid, "LISTEN_FDS": "0"}, false},
+		{"invalid count", map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "many"}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnvironment("PLATFORM_")
+			env.SetSources(MapSource(tt.vars))
+
+			got, err := env.SystemdListeners()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, got)
+		})
+	}
+}
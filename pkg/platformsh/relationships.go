@@ -5,11 +5,13 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/globalsign/mgo"
+	"github.com/go-sql-driver/mysql"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -38,78 +40,246 @@ type (
 	}
 )
 
-// ElasticSearch
-// InfluxDB
-// Kafka
-// Memcached
-// MongoDB
-// MySQL
-// PostgreSQL
-// Redis
-// RabbitMQ
-// Solr
+// Query keys Platform.sh uses to describe a relationship rather than to
+// configure the connection.
+var relationshipMetadata = map[string]bool{
+	"is_master": true,
+}
 
+// URL formats the relationship as a URL. Credentials and query values are
+// escaped and query parameters are sorted by key.
 func (r Relationship) URL(user, query bool) string {
-	var b strings.Builder
-	b.WriteString(r.Scheme)
-	b.WriteString("://")
+	rv := r.connectionURL(r.Scheme, user)
+	if !query {
+		rv.RawQuery = ""
+	}
+	return rv.String()
+}
 
-	if user && r.Username != "" {
-		b.WriteString(r.Username)
-		if r.Password != "" {
-			b.WriteString(":")
-			b.WriteString(r.Password)
-		}
-		b.WriteString("@")
+func (r Relationship) HostPort() string {
+	if r.Port <= 0 {
+		return r.Host
 	}
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+}
+
+func (r Relationship) secure() bool {
+	return r.SSLSettings().Enabled()
+}
 
-	b.WriteString(r.Host)
-	if r.Port > 0 {
-		fmt.Fprintf(&b, ":%d", r.Port)
+func (r Relationship) query() url.Values {
+	rv := make(url.Values, len(r.Query))
+	for k, v := range r.Query {
+		if relationshipMetadata[k] {
+			continue
+		}
+		rv.Set(k, fmt.Sprint(v))
 	}
+	return rv
+}
 
-	if r.Path != "" {
-		b.WriteString("/")
-		b.WriteString(r.Path)
+func (r Relationship) connectionURL(scheme string, user bool) *url.URL {
+	rv := url.URL{
+		Scheme:   scheme,
+		Host:     r.HostPort(),
+		RawQuery: r.query().Encode(),
 	}
 
-	if query {
-		b.WriteString("?")
-		first := true
-		for k, v := range r.Query {
-			if !first {
-				b.WriteString("&")
-			}
-			first = false
-			fmt.Fprintf(&b, "%s=%v", k, v)
+	if user && r.Username != "" {
+		if r.Password != "" {
+			rv.User = url.UserPassword(r.Username, r.Password)
+		} else {
+			rv.User = url.User(r.Username)
 		}
 	}
 
-	return b.String()
+	if r.Path != "" {
+		rv.Path = "/" + strings.TrimPrefix(r.Path, "/")
+	}
+
+	return &rv
 }
 
-func (r Relationships) MongoDB(name string) (*mgo.Database, error) {
+func (r Relationship) httpURL() string {
+	scheme := "http"
+	if r.secure() {
+		scheme = "https"
+	}
+	return r.connectionURL(scheme, true).String()
+}
+
+func (r Relationships) lookup(name string) ([]Relationship, error) {
 	rels, ok := r[name]
 	if !ok {
-		return nil, errors.New("missing relationship")
+		return nil, errors.Errorf("missing relationship %q", name)
 	}
 
 	if len(rels) == 0 {
-		return nil, errors.New("empty relationship")
+		return nil, errors.Errorf("empty relationship %q", name)
+	}
+
+	return rels, nil
+}
+
+// each formats every host of the relationship, in order. Accessors return
+// one value per host and leave choosing between them, and failing over, to
+// the caller; only MongoDBURL covers every host in a single value, as its
+// drivers expect.
+func (r Relationships) each(name string, format func(idx int, rel Relationship) (string, error)) ([]string, error) {
+	rels, err := r.lookup(name)
+	if err != nil {
+		return nil, err
 	}
 
-	hosts := make([]string, len(rels))
+	rv := make([]string, len(rels))
 	for idx, rel := range rels {
-		hosts[idx] = net.JoinHostPort(rel.Host, strconv.Itoa(rel.Port))
+		if rv[idx], err = format(idx, rel); err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+func (r Relationships) hostPorts(name string) ([]string, error) {
+	return r.each(name, func(_ int, rel Relationship) (string, error) {
+		return rel.HostPort(), nil
+	})
+}
+
+func (r Relationships) httpURLs(name string) ([]string, error) {
+	return r.each(name, func(_ int, rel Relationship) (string, error) {
+		return rel.httpURL(), nil
+	})
+}
+
+// ElasticSearch returns the base URL of every node in the relationship.
+func (r Relationships) ElasticSearch(name string) ([]string, error) {
+	return r.httpURLs(name)
+}
+
+// InfluxDB returns the HTTP API URL of every host in the relationship.
+func (r Relationships) InfluxDB(name string) ([]string, error) {
+	return r.httpURLs(name)
+}
+
+// Kafka returns the broker list for the relationship.
+func (r Relationships) Kafka(name string) ([]string, error) {
+	return r.hostPorts(name)
+}
+
+// Memcached returns the server list for the relationship.
+func (r Relationships) Memcached(name string) ([]string, error) {
+	return r.hostPorts(name)
+}
+
+// MySQL returns a github.com/go-sql-driver/mysql DSN for every host in the
+// relationship. A custom CA or client certificate is registered with the
+// driver as the TLS config "platformsh-<name>-<index>".
+func (r Relationships) MySQL(name string) ([]string, error) {
+	return r.each(name, func(idx int, rel Relationship) (string, error) {
+		query := rel.query()
+		if query.Get("tls") == "" {
+			switch ssl := rel.SSLSettings(); {
+			case !ssl.Enabled():
+			case ssl.Mode == SSLModeRequire || ssl.InsecureSkipVerify:
+				query.Set("tls", "skip-verify")
+			case ssl.CA != "" || ssl.Cert != "" || ssl.Key != "":
+				cfg, err := rel.TLSConfig()
+				if err != nil {
+					return "", err
+				}
+				key := fmt.Sprintf("platformsh-%s-%d", name, idx)
+				if err := mysql.RegisterTLSConfig(key, cfg); err != nil {
+					return "", errors.Wrap(err, "unable to register the mysql TLS config")
+				}
+				query.Set("tls", key)
+			default:
+				query.Set("tls", "true")
+			}
+		}
+
+		var b strings.Builder
+		if rel.Username != "" {
+			b.WriteString(rel.Username)
+			if rel.Password != "" {
+				b.WriteString(":")
+				b.WriteString(rel.Password)
+			}
+			b.WriteString("@")
+		}
+		fmt.Fprintf(&b, "tcp(%s)/%s", rel.HostPort(), rel.Path)
+		if len(query) > 0 {
+			b.WriteString("?")
+			b.WriteString(query.Encode())
+		}
+
+		return b.String(), nil
+	})
+}
+
+// Redis returns a redis:// or rediss:// URL, with the password, for every
+// host in the relationship.
+func (r Relationships) Redis(name string) ([]string, error) {
+	return r.each(name, func(_ int, rel Relationship) (string, error) {
+		scheme := "redis"
+		if rel.secure() {
+			scheme = "rediss"
+		}
+
+		rv := rel.connectionURL(scheme, true)
+		if rel.Username == "" && rel.Password != "" {
+			// redis://:password@host:port
+			rv.User = url.UserPassword("", rel.Password)
+		}
+		return rv.String(), nil
+	})
+}
+
+// RabbitMQ returns an AMQP URL for every host in the relationship.
+func (r Relationships) RabbitMQ(name string) ([]string, error) {
+	return r.each(name, func(_ int, rel Relationship) (string, error) {
+		scheme := "amqp"
+		if rel.secure() {
+			scheme = "amqps"
+		}
+
+		rv := rel.connectionURL(scheme, true)
+		if rv.Path == "" {
+			rv.Path = "/"
+		}
+		return rv.String(), nil
+	})
+}
+
+// Solr returns the core URL for every host in the relationship.
+func (r Relationships) Solr(name string) ([]string, error) {
+	return r.httpURLs(name)
+}
+
+// MongoDBURL returns a connection string covering every host in the
+// relationship. Credentials are left out; see MongoDB.
+func (r Relationships) MongoDBURL(name string) (string, error) {
+	hosts, err := r.hostPorts(name)
+	if err != nil {
+		return "", err
 	}
 
-	var b strings.Builder
-	b.WriteString("mongodb://")
-	b.WriteString(strings.Join(hosts, ","))
-	b.WriteString("/")
-	b.WriteString(rels[0].Path)
+	rel := r[name][0]
+	rv := url.URL{
+		Scheme:   "mongodb",
+		Host:     strings.Join(hosts, ","),
+		Path:     "/" + rel.Path,
+		RawQuery: rel.query().Encode(),
+	}
+	return rv.String(), nil
+}
 
-	url := b.String()
+func (r Relationships) MongoDB(name string) (*mgo.Database, error) {
+	url, err := r.MongoDBURL(name)
+	if err != nil {
+		return nil, err
+	}
+	rels := r[name]
 
 	mgo.SetLogger(log.New(os.Stderr, "mongo ", log.LstdFlags))
 
@@ -129,31 +299,70 @@ func (r Relationships) MongoDB(name string) (*mgo.Database, error) {
 	return nil, errors.New("failed to connect to mongo server")
 }
 
+// Postgresql returns a lib/pq connection string for a random host of the
+// relationship. Unlike the other accessors it picks the host itself, as
+// callers of this long-standing accessor expect a single DSN. lib/pq only
+// reads certificates from files, so hosts with inline PEM data fail; dial
+// those with PostgresqlDriverDialer.
 func (r Relationships) Postgresql(name string) (string, error) {
-	rels, ok := r[name]
-	if !ok {
-		return "", errors.New("missing relationship")
+	shared, err := r.lookup(name)
+	if err != nil {
+		return "", err
 	}
 
-	if len(rels) == 0 {
-		return "", errors.New("empty relationship")
-	}
+	// shuffle a copy; the relationships may be shared by other callers
+	rels := make([]Relationship, len(shared))
+	copy(rels, shared)
 
+	err = errors.New("error parsing postgres url")
 	for len(rels) > 0 {
 		rand.Shuffle(len(rels), func(i, j int) {
 			rels[i], rels[j] = rels[j], rels[i]
 		})
 
-		dbURL := rels[0].URL(true, false)
-		dbURL = strings.Replace(dbURL, "pgsql://", "postgresql://", 1)
-		dbOpen, err := pq.ParseURL(dbURL)
-		if err == nil {
-			dbOpen += " sslmode=disable"
+		var dbOpen string
+		if dbOpen, err = rels[0].postgresql(nil); err == nil {
 			return dbOpen, nil
 		}
 
 		rels = rels[1:]
 	}
 
-	return "", errors.New("error parsing postgres url")
+	return "", err
+}
+
+// postgresql writes inline certificates with files; without files they are
+// an error.
+func (r Relationship) postgresql(files *PEMFiles) (string, error) {
+	u := r.connectionURL("postgresql", true)
+	query := u.Query()
+
+	// lib/pq only accepts file paths for the certificate parameters
+	ssl := r.SSLSettings()
+	query.Set("sslmode", ssl.Mode)
+	for param, value := range map[string]string{
+		"sslrootcert": ssl.CA,
+		"sslcert":     ssl.Cert,
+		"sslkey":      ssl.Key,
+	} {
+		if value == "" {
+			continue
+		}
+		if files == nil {
+			if inlinePEM(value) {
+				return "", errors.Errorf("lib/pq can't read inline PEM data for %s", param)
+			}
+			query.Set(param, value)
+			continue
+		}
+
+		path, err := files.Path(value)
+		if err != nil {
+			return "", err
+		}
+		query.Set(param, path)
+	}
+	u.RawQuery = query.Encode()
+
+	return pq.ParseURL(u.String())
 }
@@ -0,0 +1,330 @@
+package platformsh
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPlaceholder = "{default}"
+	allPlaceholder     = "{all}"
+)
+
+// RouteResolver expands the `{default}` and `{all}` placeholders used by
+// routes.yaml. When All is empty, `{all}` expands to the Default domain.
+type RouteResolver struct {
+	Default string
+	All     []string
+}
+
+// RouteMatch is the result of matching a URL against Routes. Redirect is
+// empty when the matched route does not redirect the URL.
+type RouteMatch struct {
+	URL      url.URL
+	Route    Route
+	Upstream string
+	Redirect string
+	Code     int
+	Expires  time.Duration
+}
+
+func (r RouteResolver) domains(template string) []string {
+	if !strings.Contains(template, allPlaceholder) || len(r.All) == 0 {
+		return []string{r.Default}
+	}
+
+	return r.All
+}
+
+func (r RouteResolver) expand(template, domain string) string {
+	template = strings.Replace(template, defaultPlaceholder, r.Default, -1)
+	return strings.Replace(template, allPlaceholder, domain, -1)
+}
+
+func (r RouteResolver) Expand(template string) []string {
+	logrus.Trace("RouteResolver.Expand")
+	domains := r.domains(template)
+	rv := make([]string, len(domains))
+	for idx, domain := range domains {
+		rv[idx] = r.expand(template, domain)
+	}
+	return rv
+}
+
+func (r RouteResolver) Resolve(templates map[string]Route) (Routes, error) {
+	logrus.Trace("RouteResolver.Resolve")
+	rv := make(Routes, len(templates))
+	for template, route := range templates {
+		for _, domain := range r.domains(template) {
+			key, err := url.Parse(r.expand(template, domain))
+			if err != nil {
+				return nil, err
+			}
+
+			expanded := route
+			expanded.OriginalURL = template
+			if expanded.To != "" {
+				expanded.To = r.expand(expanded.To, domain)
+			}
+
+			rv[*key] = expanded
+		}
+	}
+	return rv, nil
+}
+
+func (r Routes) OriginalURLs() map[string][]url.URL {
+	logrus.Trace("Routes.OriginalURLs")
+	rv := make(map[string][]url.URL)
+	for k, v := range r {
+		rv[v.OriginalURL] = append(rv[v.OriginalURL], k)
+	}
+
+	for _, urls := range rv {
+		sort.Slice(urls, func(i, j int) bool {
+			return urls[i].String() < urls[j].String()
+		})
+	}
+
+	return rv
+}
+
+func (r Routes) Match(u *url.URL) (RouteMatch, bool) {
+	logrus.Trace("Routes.Match")
+	var (
+		best     RouteMatch
+		bestRank = -1
+	)
+
+	for k, v := range r {
+		rank, ok := matchRoute(&k, u)
+		if !ok || rank < bestRank {
+			continue
+		}
+
+		if rank == bestRank && k.String() > best.URL.String() {
+			// keep the outcome stable for identical ranks
+			continue
+		}
+
+		best = RouteMatch{URL: k, Route: v}
+		bestRank = rank
+	}
+
+	if bestRank < 0 {
+		return RouteMatch{}, false
+	}
+
+	best.Upstream = strings.SplitN(best.Route.Upstream, ":", 2)[0]
+	switch best.Route.Type {
+	case "redirect":
+		suffix := strings.TrimPrefix(u.Path, best.URL.Path)
+		best.Redirect = withQuery(joinPath(best.Route.To, suffix), u)
+		best.Code = http.StatusMovedPermanently
+		best.Expires = best.Route.Redirects.Expires.Duration
+	default:
+		if target, rule, ok := best.Route.Redirects.Paths.Match(u); ok {
+			best.Redirect = target
+			best.Code = rule.StatusCode()
+			best.Expires = rule.Expires.Duration
+			if best.Expires == 0 {
+				best.Expires = best.Route.Redirects.Expires.Duration
+			}
+		}
+	}
+
+	return best, true
+}
+
+// matchRoute ranks how well the route key matches u. Longer paths win and
+// exact hosts win over wildcard hosts.
+func matchRoute(key, u *url.URL) (int, bool) {
+	if !strings.EqualFold(key.Scheme, u.Scheme) {
+		return 0, false
+	}
+
+	exact, ok := matchHost(key.Hostname(), u.Hostname())
+	if !ok || port(key) != port(u) {
+		return 0, false
+	}
+
+	path := key.Path
+	if path == "" {
+		path = "/"
+	}
+
+	reqPath := u.Path
+	if reqPath == "" {
+		reqPath = "/"
+	}
+
+	if !strings.HasPrefix(reqPath, path) && reqPath+"/" != path {
+		return 0, false
+	}
+
+	rank := len(path) * 2
+	if exact {
+		rank++
+	}
+	return rank, true
+}
+
+func matchHost(pattern, host string) (exact, ok bool) {
+	if strings.EqualFold(pattern, host) {
+		return true, true
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		if len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix)) {
+			return false, true
+		}
+	}
+
+	return false, false
+}
+
+func port(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+
+	return ""
+}
+
+// Match finds the redirect rule that applies to u and returns the target
+// location. Exact paths take precedence, followed by the longest matching
+// prefix, followed by regular expressions in lexical order.
+func (p RedirectPaths) Match(u *url.URL) (string, RedirectPath, bool) {
+	logrus.Trace("RedirectPaths.Match")
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	for _, k := range keys {
+		if v := p[k]; !v.Regexp && k == path {
+			return resolveTarget(u, v.To, path), v, true
+		}
+	}
+
+	// longest prefix first
+	sort.SliceStable(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j])
+	})
+	for _, k := range keys {
+		v := p[k]
+		if v.Regexp || !v.Prefix || !hasPathPrefix(path, k) {
+			continue
+		}
+
+		target := v.To
+		if v.AppendSuffix {
+			target = joinPath(target, path[len(k):])
+		}
+		return resolveTarget(u, target, path), v, true
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := p[k]
+		if !v.Regexp {
+			continue
+		}
+
+		re, err := regexp.Compile(k)
+		if err != nil {
+			logrus.WithError(err).WithField("regexp", k).Warn("invalid redirect regexp")
+			continue
+		}
+
+		match := re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+
+		target := string(re.ExpandString(nil, v.To, path, match))
+		return resolveTarget(u, target, path), v, true
+	}
+
+	return "", RedirectPath{}, false
+}
+
+// StatusCode returns the HTTP status for the redirect. Like the Platform.sh
+// router, it defaults to 302 Found when Code is unset.
+func (p RedirectPath) StatusCode() int {
+	if validRedirectCode(p.Code) {
+		return p.Code
+	}
+	return http.StatusFound
+}
+
+// validRedirectCode reports whether the router accepts code for a redirect.
+func validRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return strings.HasSuffix(prefix, "/") || len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+func resolveTarget(u *url.URL, target, path string) string {
+	ref, err := url.Parse(target)
+	if err != nil {
+		logrus.WithError(err).WithField("target", target).Warn("invalid redirect target")
+		return target
+	}
+
+	base := *u
+	base.Path = path
+	rv := base.ResolveReference(ref)
+	if rv.RawQuery == "" {
+		rv.RawQuery = u.RawQuery
+	}
+	return rv.String()
+}
+
+func joinPath(base, suffix string) string {
+	if suffix == "" {
+		return base
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(suffix, "/")
+}
+
+func withQuery(target string, u *url.URL) string {
+	if u.RawQuery == "" || strings.Contains(target, "?") {
+		return target
+	}
+
+	return target + "?" + u.RawQuery
+}
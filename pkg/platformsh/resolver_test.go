@@ -0,0 +1,193 @@
+package platformsh_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+var resolver = RouteResolver{
+	Default: "example.com",
+	All:     []string{"example.com", "example.org"},
+}
+
+var routeTemplates = map[string]Route{
+	"https://{default}/": {
+		Type:     "upstream",
+		Upstream: "app:http",
+		Redirects: Redirects{
+			Expires: Duration{time.Hour},
+			Paths: RedirectPaths{
+				"/old": {
+					To:           "/new",
+					Prefix:       true,
+					AppendSuffix: true,
+					Code:         302,
+				},
+				"/exact": {
+					To:      "https://example.net/",
+					Code:    308,
+					Expires: Duration{time.Minute},
+				},
+				"^/blog/(\\d+)$": {
+					Regexp: true,
+					To:     "/posts/$1",
+				},
+				"/trunc": {
+					To:     "/",
+					Prefix: true,
+				},
+			},
+		},
+	},
+	"https://api.{default}/": {
+		Type:     "upstream",
+		Upstream: "api:http",
+	},
+	"https://{all}/static/": {
+		Type:     "upstream",
+		Upstream: "static:http",
+	},
+	"https://*.{default}/": {
+		Type:     "upstream",
+		Upstream: "wildcard:http",
+	},
+	"http://{all}/": {
+		Type: "redirect",
+		To:   "https://{all}/",
+	},
+}
+
+func TestRouteResolver_Expand(t *testing.T) {
+	tests := []struct {
+		template string
+		want     []string
+	}{
+		{"https://{default}/", []string{"https://example.com/"}},
+		{"https://www.{default}/", []string{"https://www.example.com/"}},
+		{"https://{all}/", []string{"https://example.com/", "https://example.org/"}},
+		{"https://static.example.net/", []string{"https://static.example.net/"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.template, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolver.Expand(tt.template))
+		})
+	}
+
+	t.Run("no domains", func(t *testing.T) {
+		r := RouteResolver{Default: "example.com"}
+		assert.Equal(t, []string{"https://example.com/"}, r.Expand("https://{all}/"))
+	})
+}
+
+func TestRouteResolver_Resolve(t *testing.T) {
+	routes, err := resolver.Resolve(routeTemplates)
+	require.NoError(t, err)
+	assert.Len(t, routes, 7)
+
+	redirect, ok := routes[mustURL("http://example.org/")]
+	require.True(t, ok)
+	assert.Equal(t, "https://example.org/", redirect.To)
+	assert.Equal(t, "http://{all}/", redirect.OriginalURL)
+
+	original := routes.OriginalURLs()
+	assert.Equal(t, []url.URL{
+		mustURL("https://example.com/static/"),
+		mustURL("https://example.org/static/"),
+	}, original["https://{all}/static/"])
+	assert.Equal(t, []url.URL{mustURL("https://example.com/")}, original["https://{default}/"])
+}
+
+func TestRoutes_Match(t *testing.T) {
+	routes, err := resolver.Resolve(routeTemplates)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		url      string
+		ok       bool
+		route    string
+		upstream string
+		redirect string
+		code     int
+		expires  time.Duration
+	}{
+		{"root", "https://example.com/", true, "https://example.com/", "app", "", 0, 0},
+		{"empty path", "https://example.com", true, "https://example.com/", "app", "", 0, 0},
+		{"subdomain", "https://api.example.com/v1", true, "https://api.example.com/", "api", "", 0, 0},
+		{"wildcard", "https://www.example.com/", true, "https://*.example.com/", "wildcard", "", 0, 0},
+		{"longest path", "https://example.org/static/app.js", true, "https://example.org/static/", "static", "", 0, 0},
+		{"unknown host", "https://example.net/", false, "", "", "", 0, 0},
+		{"unknown port", "https://example.com:8443/", false, "", "", "", 0, 0},
+		{"scheme redirect", "http://example.org/foo?bar=baz", true, "http://example.org/", "", "https://example.org/foo?bar=baz", 301, 0},
+		{"prefix", "https://example.com/old/path", true, "https://example.com/", "app", "https://example.com/new/path", 302, time.Hour},
+		{"prefix root", "https://example.com/old", true, "https://example.com/", "app", "https://example.com/new", 302, time.Hour},
+		{"prefix sibling", "https://example.com/older", true, "https://example.com/", "app", "", 0, 0},
+		{"prefix without suffix", "https://example.com/trunc/a/b?q=1", true, "https://example.com/", "app", "https://example.com/?q=1", 302, time.Hour},
+		{"exact", "https://example.com/exact", true, "https://example.com/", "app", "https://example.net/", 308, time.Minute},
+		{"exact child", "https://example.com/exact/child", true, "https://example.com/", "app", "", 0, 0},
+		{"regexp", "https://example.com/blog/42", true, "https://example.com/", "app", "https://example.com/posts/42", 302, time.Hour},
+		{"regexp mismatch", "https://example.com/blog/latest", true, "https://example.com/", "app", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			m, ok := routes.Match(u)
+			assert.Equal(t, tt.ok, ok)
+			if !tt.ok {
+				return
+			}
+
+			assert.Equal(t, tt.route, m.URL.String())
+			assert.Equal(t, tt.upstream, m.Upstream)
+			assert.Equal(t, tt.redirect, m.Redirect)
+			assert.Equal(t, tt.code, m.Code)
+			assert.Equal(t, tt.expires, m.Expires)
+		})
+	}
+}
+
+func TestRedirectPath_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		code    int
+		wantErr bool
+	}{
+		{"unset", `{"to": "/new"}`, 302, false},
+		{"permanent", `{"to": "/new", "code": 301}`, 301, false},
+		{"temporary", `{"to": "/new", "code": 307}`, 307, false},
+		{"see other", `{"to": "/new", "code": 303}`, 0, true},
+		{"not a redirect", `{"to": "/new", "code": 200}`, 0, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var rv RedirectPath
+			err := json.Unmarshal([]byte(tt.data), &rv)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.code, rv.StatusCode())
+		})
+	}
+
+	var routes Routes
+	err := json.Unmarshal([]byte(`{"https://example.com/": {"type": "upstream", "redirects": {"paths": {"/old": {"to": "/new", "code": 303}}}}}`), &routes)
+	assert.Error(t, err)
+}
@@ -44,10 +44,13 @@ type Duration struct {
 }
 
 type HTTPAccess struct {
-	Addresses []string          `json:"addresses"`
+	Addresses []AccessAddress   `json:"addresses"`
 	BasicAuth map[string]string `json:"basic_auth"`
 }
 
+// RedirectPath is a single `redirects.paths` rule. Code may be 301, 302, 307
+// or 308, or unset for 302; rules with another code are rejected when routes
+// are loaded.
 type RedirectPath struct {
 	Regexp       bool     `json:"regexp"`
 	To           string   `json:"to"`
@@ -156,6 +159,18 @@ func (v Duration) MarshalText() ([]byte, error) {
 	return []byte(v.String()), nil
 }
 
+func (p *RedirectPath) UnmarshalJSON(data []byte) error {
+	logrus.Trace("RedirectPath.UnmarshalJSON")
+	type plain RedirectPath
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	if p.Code != 0 && !validRedirectCode(p.Code) {
+		return fmt.Errorf("invalid redirect code %d for %q", p.Code, p.To)
+	}
+	return nil
+}
+
 func (r *Routes) UnmarshalJSON(text []byte) error {
 	logrus.Trace("Routes.UnmarshalJSON")
 	var intermediate map[string]Route
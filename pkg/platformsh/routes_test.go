@@ -182,7 +182,7 @@ MC4CAQACBTQ6QL+/AgMBAAECBQpbhD15AgMH2IsCAwaoHQIDBAh7AgI0ZQIDBA0b
 					OriginalURL:    "https://{default}/",
 					RestrictRobots: true,
 					HTTPAccess: HTTPAccess{
-						Addresses: make([]string, 0),
+						Addresses: make([]AccessAddress, 0),
 						BasicAuth: make(map[string]string),
 					},
 				},
@@ -197,7 +197,7 @@ MC4CAQACBTQ6QL+/AgMBAAECBQpbhD15AgMH2IsCAwaoHQIDBAh7AgI0ZQIDBA0b
 					OriginalURL:    "http://{default}/",
 					RestrictRobots: true,
 					HTTPAccess: HTTPAccess{
-						Addresses: make([]string, 0),
+						Addresses: make([]AccessAddress, 0),
 						BasicAuth: make(map[string]string),
 					},
 				},
@@ -0,0 +1,283 @@
+package platformsh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// RedactedValue replaces secrets in a redacted snapshot.
+const RedactedValue = "REDACTED"
+
+// Snapshot is a portable copy of an environment. Variables are keyed by
+// their WellKnownVariable name and hold the decoded value; Extra holds any
+// additional raw variables by their full name.
+type Snapshot struct {
+	Prefix    string                 `json:"prefix"`
+	Created   time.Time              `json:"created"`
+	Redacted  bool                   `json:"redacted,omitempty"`
+	Variables map[string]interface{} `json:"variables"`
+	Extra     map[string]string      `json:"extra,omitempty"`
+	Errors    map[string]string      `json:"errors,omitempty"`
+}
+
+type SnapshotOptions struct {
+	// Redact replaces secrets, project variable values, relationship
+	// passwords and inline private keys, basic auth passwords and every Extra
+	// value with RedactedValue.
+	Redact bool
+	// Extra names additional variables to capture, e.g. PKI_ROOT_CERTIFICATE.
+	Extra []string
+}
+
+// TakeSnapshot captures every WellKnownVariable set in env. A value that
+// fails to decode is recorded in Errors instead.
+func TakeSnapshot(env Environment, opts SnapshotOptions) Snapshot {
+	logrus.Trace("TakeSnapshot")
+
+	s := Snapshot{
+		Prefix:    env.Prefix(),
+		Created:   time.Now().UTC(),
+		Redacted:  opts.Redact,
+		Variables: make(map[string]interface{}),
+		Extra:     make(map[string]string),
+		Errors:    make(map[string]string),
+	}
+
+	for _, v := range WellKnownVariables {
+		raw, ok := env.Lookup(v.Key(s.Prefix))
+		if !ok {
+			continue
+		}
+
+		if _, err := v.Get(env); err != nil {
+			s.Errors[v.Name] = err.Error()
+			continue
+		}
+
+		var value interface{} = raw
+		if v.Decoded {
+			data, _ := base64.StdEncoding.DecodeString(raw)
+			if err := json.Unmarshal(data, &value); err != nil {
+				s.Errors[v.Name] = err.Error()
+				continue
+			}
+		}
+
+		if opts.Redact {
+			value = redactVariable(v, value)
+		}
+		s.Variables[v.Name] = value
+	}
+
+	for _, name := range opts.Extra {
+		if raw, ok := env.Lookup(name); ok {
+			if opts.Redact {
+				raw = RedactedValue
+			}
+			s.Extra[name] = raw
+		}
+	}
+
+	return s
+}
+
+func redactVariable(v WellKnownVariable, value interface{}) interface{} {
+	if v.Secret {
+		return RedactedValue
+	}
+
+	switch v.Name {
+	case "Variables":
+		// {"env:NAME": "value"}; project variables are often credentials
+		vars, _ := value.(map[string]interface{})
+		for name := range vars {
+			redactKey(vars, name)
+		}
+	case "Relationships":
+		// {"name": [{"password": "...", "ssl": {"key": "-----BEGIN ..."}}]}
+		rels, _ := value.(map[string]interface{})
+		for _, hosts := range rels {
+			hosts, _ := hosts.([]interface{})
+			for _, host := range hosts {
+				host, ok := host.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				redactKey(host, "password")
+				ssl, _ := host["ssl"].(map[string]interface{})
+				for _, key := range []string{"key", "sslkey"} {
+					if pem, ok := ssl[key].(string); ok && inlinePEM(pem) {
+						redactKey(ssl, key)
+					}
+				}
+			}
+		}
+	case "Routes":
+		// {"url": {"http_access": {"basic_auth": {"user": "password"}}}}
+		routes, _ := value.(map[string]interface{})
+		for _, route := range routes {
+			route, _ := route.(map[string]interface{})
+			access, _ := route["http_access"].(map[string]interface{})
+			auth, _ := access["basic_auth"].(map[string]interface{})
+			for user := range auth {
+				redactKey(auth, user)
+			}
+		}
+	}
+
+	return value
+}
+
+func redactKey(obj map[string]interface{}, key string) {
+	if v, ok := obj[key]; ok && v != nil && v != "" {
+		obj[key] = RedactedValue
+	}
+}
+
+// Write encodes the snapshot as json or yaml.
+func (s Snapshot) Write(w io.Writer, format string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "yaml":
+		// round trip through interface{} so yaml uses the json field names
+		var obj interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return errors.Errorf("unknown snapshot format %q", format)
+	}
+}
+
+// ReadSnapshot decodes a snapshot written as json or yaml.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON
+	var obj interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, errors.Wrap(err, "unable to parse snapshot")
+	}
+
+	data, err = json.Marshal(jsonValue(obj))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse snapshot")
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Wrap(err, "unable to parse snapshot")
+	}
+	return &s, nil
+}
+
+// Source encodes the snapshot back into environment variables. The values
+// of a redacted snapshot that were replaced with RedactedValue are left out,
+// so that they are missing or come from another source rather than being
+// replayed as the placeholder.
+func (s Snapshot) Source() (VariableSource, error) {
+	rv := make(MapSource, len(s.Variables)+len(s.Extra))
+	for name, value := range s.Variables {
+		v, ok := LookupWellKnownVariable(name)
+		if !ok {
+			return nil, errors.Errorf("unknown variable %q in snapshot", name)
+		}
+
+		if s.Redacted {
+			if value == RedactedValue {
+				continue
+			}
+			value = dropRedacted(value)
+		}
+
+		if v.Decoded {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to encode %s", name)
+			}
+			rv[v.Key(s.Prefix)] = base64.StdEncoding.EncodeToString(data)
+		} else if str, ok := value.(string); ok {
+			rv[v.Key(s.Prefix)] = str
+		} else {
+			rv[v.Key(s.Prefix)] = fmt.Sprint(value)
+		}
+	}
+
+	for name, value := range s.Extra {
+		if s.Redacted && value == RedactedValue {
+			continue
+		}
+		rv[name] = value
+	}
+	return snapshotSource{rv}, nil
+}
+
+// dropRedacted returns a copy of value without the object keys whose value
+// is RedactedValue.
+func dropRedacted(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		rv := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			if v != RedactedValue {
+				rv[k] = dropRedacted(v)
+			}
+		}
+		return rv
+	case []interface{}:
+		rv := make([]interface{}, len(value))
+		for idx, v := range value {
+			rv[idx] = dropRedacted(v)
+		}
+		return rv
+	default:
+		return value
+	}
+}
+
+// Environment replays the snapshot. The returned environment reads nothing
+// from the process environment or the file system.
+func (s Snapshot) Environment() (Environment, error) {
+	src, err := s.Source()
+	if err != nil {
+		return nil, err
+	}
+
+	env := NewEnvironment(s.Prefix)
+	env.SetFileSystem(afero.NewMemMapFs())
+	env.SetSources(src)
+	return env, nil
+}
+
+type snapshotSource struct {
+	MapSource
+}
+
+func (snapshotSource) Name() string {
+	return "snapshot"
+}
@@ -0,0 +1,261 @@
+package platformsh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// VariableSource supplies environment variables to an Environment.
+type VariableSource interface {
+	Name() string
+	Lookup(name string) (string, bool)
+}
+
+// Reloader is implemented by sources that cache their values.
+type Reloader interface {
+	// Changed reports whether the backing data changed since it was read.
+	Changed() bool
+	Reload() error
+}
+
+// VariableSources are consulted in order; the first source with a value wins.
+type VariableSources []VariableSource
+
+func (s VariableSources) Lookup(name string) (string, bool) {
+	v, src, ok := s.LookupSource(name)
+	if ok {
+		logrus.WithField("source", src.Name()).Tracef("found %s", name)
+	}
+	return v, ok
+}
+
+// LookupSource is Lookup that also returns the source of the value.
+func (s VariableSources) LookupSource(name string) (string, VariableSource, bool) {
+	for _, src := range s {
+		if v, ok := src.Lookup(name); ok {
+			return v, src, true
+		}
+	}
+	return "", nil, false
+}
+
+// Which returns the source that supplies name.
+func (s VariableSources) Which(name string) (VariableSource, bool) {
+	_, src, ok := s.LookupSource(name)
+	return src, ok
+}
+
+type funcSource struct {
+	name string
+	fn   LookupFunc
+}
+
+// FuncSource adapts a LookupFunc into a VariableSource.
+func FuncSource(name string, fn LookupFunc) VariableSource {
+	return funcSource{name, fn}
+}
+
+// ProcessEnv is the process environment.
+func ProcessEnv() VariableSource {
+	return FuncSource("env", os.LookupEnv)
+}
+
+func (s funcSource) Name() string {
+	return s.name
+}
+
+func (s funcSource) Lookup(name string) (string, bool) {
+	return s.fn(name)
+}
+
+// MapSource is an in-memory source, useful for overrides in tests.
+type MapSource map[string]string
+
+func (MapSource) Name() string {
+	return "map"
+}
+
+func (m MapSource) Lookup(name string) (string, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
+type secretsSource struct {
+	fs  afero.Fs
+	dir string
+}
+
+// SecretsDirSource reads each variable from a file of the same name in dir,
+// e.g. a mounted secrets volume. A single trailing newline is trimmed.
+func SecretsDirSource(fs afero.Fs, dir string) VariableSource {
+	return secretsSource{fs, dir}
+}
+
+func (s secretsSource) Name() string {
+	return "secrets:" + s.dir
+}
+
+func (s secretsSource) Lookup(name string) (string, bool) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return "", false
+	}
+
+	data, err := afero.ReadFile(s.fs, path.Join(s.dir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("name", name).Warn("unable to read secret")
+		}
+		return "", false
+	}
+
+	v := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(v, "\r"), true
+}
+
+// ConfigFileSource reads variables from a flat YAML or JSON object. Scalar
+// values are used as is; objects and arrays are JSON encoded then base64
+// encoded the way Platform.sh encodes PLATFORM_* variables.
+type ConfigFileSource struct {
+	fs   afero.Fs
+	path string
+
+	mu     sync.Mutex
+	stat   fileStat
+	values map[string]string
+}
+
+func NewConfigFileSource(fs afero.Fs, path string) (*ConfigFileSource, error) {
+	s := ConfigFileSource{fs: fs, path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *ConfigFileSource) Name() string {
+	return "config:" + s.path
+}
+
+func (s *ConfigFileSource) Lookup(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[name]
+	return v, ok
+}
+
+func (s *ConfigFileSource) Changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return statFile(s.fs, s.path) != s.stat
+}
+
+func (s *ConfigFileSource) Reload() error {
+	stat := statFile(s.fs, s.path)
+
+	data, err := afero.ReadFile(s.fs, s.path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read %s", s.path)
+	}
+
+	// YAML is a superset of JSON
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return errors.Wrapf(err, "unable to parse %s", s.path)
+	}
+
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		str, err := configValue(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for %s in %s", k, s.path)
+		}
+		values[k] = str
+	}
+
+	s.mu.Lock()
+	s.values, s.stat = values, stat
+	s.mu.Unlock()
+	return nil
+}
+
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	}
+
+	data, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// jsonValue converts the map[interface{}]interface{} values produced by the
+// YAML decoder into values encoding/json can marshal.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		rv := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rv[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return rv
+	case map[string]interface{}:
+		rv := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rv[k] = jsonValue(item)
+		}
+		return rv
+	case []interface{}:
+		rv := make([]interface{}, len(v))
+		for idx, item := range v {
+			rv[idx] = jsonValue(item)
+		}
+		return rv
+	default:
+		return v
+	}
+}
+
+func statFile(fs afero.Fs, name string) fileStat {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{
+		exists:  true,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+type dotEnvSource struct {
+	e *environment
+}
+
+func (dotEnvSource) Name() string {
+	return "dotenv"
+}
+
+func (s dotEnvSource) Lookup(name string) (string, bool) {
+	s.e.ReadDotEnv()
+	s.e.dotEnvMu.Lock()
+	defer s.e.dotEnvMu.Unlock()
+	v, ok := s.e.dotEnv[name]
+	return v, ok
+}
@@ -0,0 +1,131 @@
+package platformsh_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+func TestVariableSources(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/.env", []byte("PLATFORM_PROJECT=dotenv\nPLATFORM_BRANCH=dotenv\n"), 0644))
+	require.NoError(t, afero.WriteFile(fs, "/run/secrets/PLATFORM_PROJECT_ENTROPY", []byte("secret\n"), 0600))
+	require.NoError(t, afero.WriteFile(fs, "/config.yaml", []byte(`
+PLATFORM_BRANCH: config
+PLATFORM_PORT: 8080
+PLATFORM_VARIABLES:
+  foo: bar
+  list: [1, 2]
+`), 0644))
+
+	config, err := NewConfigFileSource(fs, "/config.yaml")
+	require.NoError(t, err)
+
+	overrides := MapSource{"PLATFORM_PROJECT": "override"}
+	env := NewEnvironment("PLATFORM_")
+	env.SetFileSystem(fs)
+	env.SetSources(
+		overrides,
+		env.DotEnv(),
+		SecretsDirSource(fs, "/run/secrets"),
+		config,
+		FuncSource("test", func(name string) (string, bool) {
+			return "fallback", name == "PLATFORM_TREE_ID"
+		}),
+	)
+
+	tests := []struct {
+		name   string
+		want   string
+		source string
+	}{
+		{"PLATFORM_PROJECT", "override", "map"},
+		{"PLATFORM_BRANCH", "dotenv", "dotenv"},
+		{"PLATFORM_PROJECT_ENTROPY", "secret", "secrets:/run/secrets"},
+		{"PLATFORM_PORT", "8080", "config:/config.yaml"},
+		{"PLATFORM_TREE_ID", "fallback", "test"},
+		{"PLATFORM_MISSING", "", ""},
+		{"../config.yaml", "", ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v, ok := env.Lookup(tt.name)
+			assert.Equal(t, tt.want, v)
+			assert.Equal(t, tt.source != "", ok)
+
+			src, ok := env.Which(tt.name)
+			if tt.source == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.source, src.Name())
+		})
+	}
+
+	vars, err := env.Variables()
+	require.NoError(t, err)
+	assert.Equal(t, JSONObject{"foo": "bar", "list": []interface{}{1.0, 2.0}}, vars)
+}
+
+func TestConfigFileSource_Reload(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"PLATFORM_BRANCH": "one"}`), 0644))
+
+	config, err := NewConfigFileSource(fs, "/config.json")
+	require.NoError(t, err)
+	assert.False(t, config.Changed())
+
+	env := NewEnvironment("PLATFORM_")
+	env.SetFileSystem(fs)
+	env.SetSources(config)
+
+	var got []string
+	env.Subscribe("PLATFORM_BRANCH", func(_, value string, _ bool) {
+		got = append(got, value)
+	})
+
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`{"PLATFORM_BRANCH": "second"}`), 0644))
+	assert.True(t, config.Changed())
+	env.Reload()
+	assert.False(t, config.Changed())
+	assert.Equal(t, []string{"second"}, got)
+
+	require.NoError(t, afero.WriteFile(fs, "/config.json", []byte(`[`), 0644))
+	env.Reload()
+	v, ok := env.Lookup("PLATFORM_BRANCH")
+	assert.True(t, ok)
+	assert.Equal(t, "second", v, "a broken file keeps the previous values")
+}
+
+func TestEnvironment_DefaultSources(t *testing.T) {
+	env, _ := newTestEnvironment(t, "PLATFORM_PROJECT=dotenv\n", map[string]string{
+		"PLATFORM_PROJECT": "lookup",
+		"PLATFORM_BRANCH":  "lookup",
+	})
+
+	src, ok := env.Which("PLATFORM_PROJECT")
+	require.True(t, ok)
+	assert.Equal(t, "dotenv", src.Name())
+
+	src, ok = env.Which("PLATFORM_BRANCH")
+	require.True(t, ok)
+	assert.Equal(t, "lookup", src.Name())
+}
+
+func TestEnvironment_DotEnvInterpolatesSources(t *testing.T) {
+	env, _ := newTestEnvironment(t, "PLATFORM_BRANCH=${PLATFORM_PROJECT}-dev\n", nil)
+	env.SetSources(ProcessEnv(), MapSource{"PLATFORM_PROJECT": "layered"}, env.DotEnv())
+
+	// the reference resolves through the other sources, not the process
+	// environment alone
+	branch, err := env.Branch()
+	require.NoError(t, err)
+	assert.Equal(t, "layered-dev", branch)
+}
@@ -0,0 +1,251 @@
+package platformsh
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	SSLModeDisable    = "disable"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
+// RelationshipSSL is the decoded form of the `ssl` object of a relationship.
+// CA, Cert and Key hold either a file path or inline PEM data. Both the
+// short names and the libpq names (sslmode, sslrootcert, ...) are accepted.
+type RelationshipSSL struct {
+	Mode               string `json:"mode,omitempty"`
+	CA                 string `json:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+func (r Relationship) SSLSettings() RelationshipSSL {
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := r.SSL[k]; ok && v != nil {
+				return fmt.Sprint(v)
+			}
+		}
+		return ""
+	}
+
+	rv := RelationshipSSL{
+		Mode:       str("mode", "sslmode"),
+		CA:         str("ca", "sslrootcert"),
+		Cert:       str("cert", "sslcert"),
+		Key:        str("key", "sslkey"),
+		ServerName: str("server_name"),
+	}
+	rv.InsecureSkipVerify, _ = r.SSL["insecure_skip_verify"].(bool)
+
+	if rv.Mode == "" && len(r.SSL) > 0 {
+		rv.Mode = SSLModeVerifyFull
+		if rv.InsecureSkipVerify {
+			rv.Mode = SSLModeRequire
+		}
+	}
+	if rv.Mode == "" {
+		rv.Mode = SSLModeDisable
+	}
+
+	return rv
+}
+
+func (s RelationshipSSL) Enabled() bool {
+	return s.Mode != SSLModeDisable
+}
+
+// TLSConfig builds a tls.Config for drivers that accept one. It returns nil
+// when SSL is disabled for the relationship.
+func (r Relationship) TLSConfig() (*tls.Config, error) {
+	settings := r.SSLSettings()
+	if !settings.Enabled() {
+		return nil, nil
+	}
+
+	cfg := tls.Config{
+		ServerName: settings.ServerName,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = r.Host
+	}
+
+	switch settings.Mode {
+	case SSLModeRequire:
+		cfg.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// verify the chain but not the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChain(&cfg)
+	default:
+		cfg.InsecureSkipVerify = settings.InsecureSkipVerify
+	}
+
+	if settings.CA != "" {
+		data, err := readPEM(settings.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read ssl ca")
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in ssl ca")
+		}
+	}
+
+	if settings.Cert != "" || settings.Key != "" {
+		cert, err := readPEM(settings.Cert)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read ssl cert")
+		}
+		key, err := readPEM(settings.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read ssl key")
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ssl client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	return &cfg, nil
+}
+
+func verifyChain(cfg *tls.Config) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for idx, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[idx] = cert
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         cfg.RootCAs,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+func inlinePEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN")
+}
+
+func readPEM(value string) ([]byte, error) {
+	if inlinePEM(value) {
+		return []byte(value), nil
+	}
+	return ioutil.ReadFile(value)
+}
+
+// PEMFiles writes inline PEM data to files for drivers that only accept
+// paths, e.g. lib/pq. The files are kept in a private directory created below
+// dir of fs, which Close removes.
+type PEMFiles struct {
+	fs  afero.Fs
+	dir string
+
+	mu      sync.Mutex
+	private string
+	paths   map[[sha256.Size]byte]string
+}
+
+// NewPEMFiles creates nothing until inline data is first written. An empty
+// dir is the default temporary directory.
+func NewPEMFiles(fs afero.Fs, dir string) *PEMFiles {
+	return &PEMFiles{
+		fs:    fs,
+		dir:   dir,
+		paths: make(map[[sha256.Size]byte]string),
+	}
+}
+
+// Path returns value when it is a path, and otherwise a file holding the
+// inline data. Each value is written once.
+func (p *PEMFiles) Path(value string) (string, error) {
+	if !inlinePEM(value) {
+		return value, nil
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if path, ok := p.paths[sum]; ok {
+		return path, nil
+	}
+
+	if p.private == "" {
+		// TempDir creates the directory with mode 0700
+		dir, err := afero.TempDir(p.fs, p.dir, "platformsh-ssl-")
+		if err != nil {
+			return "", errors.Wrap(err, "unable to create a directory for inline PEM data")
+		}
+		p.private = dir
+	}
+
+	name := filepath.Join(p.private, fmt.Sprintf("%x.pem", sum[:8]))
+	fp, err := p.fs.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to write inline PEM data")
+	}
+	_, err = fp.WriteString(value)
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = p.fs.Remove(name)
+		return "", errors.Wrap(err, "unable to write inline PEM data")
+	}
+
+	// drivers open the file themselves
+	path := name
+	if base, ok := p.fs.(*afero.BasePathFs); ok {
+		if path, err = base.RealPath(name); err != nil {
+			return "", err
+		}
+	}
+
+	p.paths[sum] = path
+	return path, nil
+}
+
+// Close removes the files written so far. Later calls to Path write them
+// again.
+func (p *PEMFiles) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.private == "" {
+		return nil
+	}
+
+	err := p.fs.RemoveAll(p.private)
+	p.private = ""
+	p.paths = make(map[[sha256.Size]byte]string)
+	return err
+}
@@ -0,0 +1,29 @@
+package platformsh
+
+// WellKnownVariable describes one of the EnvironmentAPI accessors. The
+// table of them, WellKnownVariables, is generated from data/variables.yaml.
+type WellKnownVariable struct {
+	Name     string
+	EnvName  string
+	NoPrefix bool
+	Decoded  bool
+	Secret   bool
+	Get      func(EnvironmentAPI) (interface{}, error)
+}
+
+// Key is the environment variable name for the given prefix.
+func (v WellKnownVariable) Key(prefix string) string {
+	if v.NoPrefix {
+		return v.EnvName
+	}
+	return prefix + v.EnvName
+}
+
+func LookupWellKnownVariable(name string) (WellKnownVariable, bool) {
+	for _, v := range WellKnownVariables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return WellKnownVariable{}, false
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+)
+
+// maxConflicts bounds how often a Take is retried when another instance
+// updated the same bucket concurrently.
+const maxConflicts = 5
+
+// MongoStore shares buckets between instances. Buckets are updated with
+// compare-and-swap on their update time, and MongoDB removes them with a TTL
+// index once they would be full again.
+type MongoStore struct {
+	collection func() (*mgo.Collection, error)
+
+	indexMu sync.Mutex
+	indexed bool
+}
+
+type mongoBucket struct {
+	Key     string    `bson:"_id"`
+	Tokens  float64   `bson:"tokens"`
+	Updated int64     `bson:"updated"`
+	Expires time.Time `bson:"expires"`
+}
+
+// NewMongoStore looks the collection up with fn on every Take. The expiry
+// index is created on first use, so a database that is still starting
+// doesn't hold up the caller.
+func NewMongoStore(fn func() (*mgo.Collection, error)) *MongoStore {
+	return &MongoStore{collection: fn}
+}
+
+func (m *MongoStore) getCollection() (*mgo.Collection, error) {
+	col, err := m.collection()
+	if err != nil {
+		return nil, err
+	}
+
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	if !m.indexed {
+		err := col.EnsureIndex(mgo.Index{
+			Key:         []string{"expires"},
+			ExpireAfter: time.Second,
+			Background:  true,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create the expiry index")
+		}
+		m.indexed = true
+	}
+	return col, nil
+}
+
+func (m *MongoStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	col, err := m.getCollection()
+	if err != nil {
+		return Result{}, err
+	}
+
+	for i := 0; i < maxConflicts; i++ {
+		var doc mongoBucket
+		err := col.FindId(key).One(&doc)
+		found := err == nil
+		if err != nil && err != mgo.ErrNotFound {
+			return Result{}, err
+		}
+
+		var prev Bucket
+		if found {
+			prev = Bucket{Tokens: doc.Tokens, Updated: time.Unix(0, doc.Updated)}
+		}
+		next, rv := prev.Take(limit, now)
+		update := mongoBucket{
+			Key:     key,
+			Tokens:  next.Tokens,
+			Updated: next.Updated.UnixNano(),
+			Expires: now.Add(rv.Reset),
+		}
+
+		if found {
+			err = col.Update(bson.M{"_id": key, "updated": doc.Updated}, update)
+		} else {
+			err = col.Insert(update)
+		}
+
+		switch {
+		case err == nil:
+			return rv, nil
+		case err == mgo.ErrNotFound, mgo.IsDup(err):
+			continue
+		default:
+			return Result{}, err
+		}
+	}
+
+	return Result{}, errors.Errorf("too many concurrent updates to rate limit bucket %q", key)
+}
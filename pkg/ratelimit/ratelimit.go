@@ -0,0 +1,169 @@
+// Package ratelimit implements token bucket rate limiting with buckets kept
+// in memory or shared through MongoDB.
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit allows Rate requests per second on average and bursts of up to Burst
+// requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimit parses a rate like 10/s, 100/m or 1000/h, optionally followed by
+// the burst size, e.g. 10/s:20. The burst defaults to the number of requests
+// in the rate, or one.
+func ParseLimit(s string) (Limit, error) {
+	rate, burst := s, ""
+	if idx := strings.IndexByte(s, ':'); idx >= 0 {
+		rate, burst = s[:idx], s[idx+1:]
+	}
+
+	idx := strings.IndexByte(rate, '/')
+	if idx < 0 {
+		return Limit{}, errors.Errorf("invalid rate %q: expected N/s, N/m or N/h", s)
+	}
+
+	n, err := strconv.ParseFloat(rate[:idx], 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return Limit{}, errors.Errorf("invalid rate %q: expected a positive number of requests", s)
+	}
+
+	unit, ok := units[rate[idx+1:]]
+	if !ok {
+		return Limit{}, errors.Errorf("invalid rate %q: unknown unit %q", s, rate[idx+1:])
+	}
+
+	l := Limit{Rate: n / unit.Seconds(), Burst: int(math.Max(1, math.Ceil(n)))}
+	if burst != "" {
+		l.Burst, err = strconv.Atoi(burst)
+		if err != nil || l.Burst < 1 {
+			return Limit{}, errors.Errorf("invalid burst in %q: expected a positive integer", s)
+		}
+	}
+	return l, nil
+}
+
+// Result describes the state of a bucket after a request was counted
+// against it, in the terms of the RateLimit header fields.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed; zero when
+	// the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps a token bucket per key.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Bucket is the state of a token bucket. It is exported for the stores that
+// persist it.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket for the time since it was last updated and takes a
+// token if one is available. A zero bucket is full.
+func (b Bucket) Take(limit Limit, now time.Time) (Bucket, Result) {
+	burst := float64(limit.Burst)
+	tokens := burst
+	if !b.Updated.IsZero() {
+		elapsed := now.Sub(b.Updated)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(burst, b.Tokens+elapsed.Seconds()*limit.Rate)
+	}
+
+	rv := Result{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		rv.Allowed = true
+	} else {
+		rv.RetryAfter = limit.duration(1 - tokens)
+	}
+
+	rv.Remaining = int(tokens)
+	rv.Reset = limit.duration(burst - tokens)
+	return Bucket{Tokens: tokens, Updated: now}, rv
+}
+
+// Full reports whether the bucket has refilled by now, i.e. it can be
+// forgotten.
+func (b Bucket) Full(limit Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+func (l Limit) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.Rate * float64(time.Second)))
+}
+
+// MemoryStore keeps the buckets of a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+	swept   time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	limit Limit
+}
+
+// sweepInterval is how often full buckets are removed from a MemoryStore.
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]memoryBucket)}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, rv := m.buckets[key].Take(limit, now)
+	m.buckets[key] = memoryBucket{b, limit}
+	return rv, nil
+}
+
+// Len returns the number of buckets being tracked.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if b.Full(b.limit, now) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
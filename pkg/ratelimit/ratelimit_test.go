@@ -0,0 +1,116 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/ratelimit"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{"10/s:20", Limit{Rate: 10, Burst: 20}, false},
+		{"120/m", Limit{Rate: 2, Burst: 120}, false},
+		{"0.5/s", Limit{Rate: 0.5, Burst: 1}, false},
+		{"3600/h:5", Limit{Rate: 1, Burst: 5}, false},
+		{"10", Limit{}, true},
+		{"10/d", Limit{}, true},
+		{"0/s", Limit{}, true},
+		{"-1/s", Limit{}, true},
+		{"x/s", Limit{}, true},
+		{"10/s:0", Limit{}, true},
+		{"10/s:x", Limit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimit(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBucket_Take(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Unix(1500000000, 0)
+
+	var b Bucket
+	var rv Result
+
+	b, rv = b.Take(limit, now)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, rv)
+
+	b, rv = b.Take(limit, now)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second}, rv)
+
+	b, rv = b.Take(limit, now.Add(500*time.Millisecond))
+	assert.Equal(t, Result{Allowed: false, Limit: 2, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}, rv)
+
+	b, rv = b.Take(limit, now.Add(time.Second))
+	assert.True(t, rv.Allowed)
+	assert.Equal(t, 0, rv.Remaining)
+	assert.False(t, b.Full(limit, now.Add(2*time.Second)))
+	assert.True(t, b.Full(limit, now.Add(3*time.Second)))
+
+	// a clock going backwards doesn't refill the bucket
+	_, rv = b.Take(limit, now)
+	assert.False(t, rv.Allowed)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Unix(1500000000, 0)
+
+	rv, err := store.Take("a", limit, now)
+	require.NoError(t, err)
+	assert.True(t, rv.Allowed)
+
+	rv, err = store.Take("a", limit, now)
+	require.NoError(t, err)
+	assert.False(t, rv.Allowed)
+	assert.Equal(t, time.Second, rv.RetryAfter)
+
+	rv, err = store.Take("b", limit, now)
+	require.NoError(t, err)
+	assert.True(t, rv.Allowed)
+	assert.Equal(t, 2, store.Len())
+
+	// full buckets are swept
+	rv, err = store.Take("a", limit, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, rv.Allowed)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestMongoStore_Unavailable(t *testing.T) {
+	unavailable := errors.New("no reachable servers")
+	calls := 0
+	store := NewMongoStore(func() (*mgo.Collection, error) {
+		calls++
+		return nil, unavailable
+	})
+
+	limit := Limit{Rate: 1, Burst: 1}
+	_, err := store.Take("key", limit, time.Now())
+	assert.Equal(t, unavailable, err)
+
+	// the collection is looked up again for each take
+	_, err = store.Take("key", limit, time.Now())
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 2, calls)
+}
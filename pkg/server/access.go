@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// httpAccessMiddleware applies the http_access rules of the matched route.
+// When any route is restricted, requests that match no route are denied so
+// that an unexpected Host or scheme can't bypass the rules.
+func (s *Server) httpAccessMiddleware(c *gin.Context) {
+	match, ok := getRouteMatch(c)
+	if !ok {
+		if routes, err := s.Routes(); err == nil && routes.Restricted() {
+			getLogger(c).WithField("host", c.Request.Host).Info("no route matched on a restricted deployment")
+			s.problem(c, NewProblem(http.StatusForbidden, "no route matches "+c.Request.Host))
+			c.Abort()
+			return
+		}
+		c.Next()
+		return
+	}
+
+	access := match.Route.HTTPAccess
+	clientIP := s.clientIP(c)
+	ip := net.ParseIP(clientIP)
+	if len(access.Addresses) > 0 && (ip == nil || !access.Allowed(ip)) {
+		getLogger(c).WithField("ip", clientIP).WithField("route", match.URL.String()).Info("address denied")
+		s.problem(c, NewProblem(http.StatusForbidden, "access denied for "+clientIP))
+		c.Abort()
+		return
+	}
+
+	if len(access.BasicAuth) > 0 {
+		username, password, _ := c.Request.BasicAuth()
+		if !access.Authorized(username, password) {
+			c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", match.URL.Host))
+			s.problem(c, NewProblem(http.StatusUnauthorized, "invalid credentials"))
+			c.Abort()
+			return
+		}
+	}
+
+	c.Next()
+}
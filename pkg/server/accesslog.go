@@ -0,0 +1,85 @@
+package server
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+	"github.com/demosdemon/super-potato/pkg/tracing"
+)
+
+const SessionCountKey = "super-potato/pkg/server/SessionCount"
+
+// sensitiveHeaders are redacted when included in the access log.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"Set-Cookie":          true,
+	"X-Client-Cert":       true,
+}
+
+// accessLogMiddleware logs every failed request and a sample of the rest.
+func (s *Server) accessLogMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	latency := time.Since(start)
+
+	code := c.Writer.Status()
+	if code < http.StatusBadRequest && rand.Float64() >= s.AccessLogSample {
+		return
+	}
+
+	size := c.Writer.Size()
+	if size < 0 {
+		size = 0
+	}
+
+	fields := logrus.Fields{
+		"method":     c.Request.Method,
+		"route":      s.routeLabel(c),
+		"path":       c.Request.URL.Path,
+		"status":     code,
+		"latency_ms": float64(latency) / float64(time.Millisecond),
+		"bytes":      size,
+		"client_ip":  s.clientIP(c),
+		"user":       getUser(c).UserName(),
+	}
+	if sc := tracing.FromContext(c.Request.Context()).Context(); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID.String()
+	}
+	if count, ok := c.Get(SessionCountKey); ok {
+		fields["session_count"] = count
+	}
+	for _, name := range s.AccessLogHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if v := c.GetHeader(name); v != "" {
+			fields["header."+strings.ToLower(name)] = redactHeader(name, v)
+		}
+	}
+	if len(c.Errors) > 0 {
+		fields["errors"] = c.Errors.String()
+	}
+
+	entry := getLogger(c).WithFields(fields)
+	switch {
+	case code >= http.StatusInternalServerError:
+		entry.Error("request")
+	case code >= http.StatusBadRequest:
+		entry.Warn("request")
+	default:
+		entry.Info("request")
+	}
+}
+
+func redactHeader(name, value string) string {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return platformsh.Redact(value)
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSRFTestServer(t *testing.T) *testServer {
+	ts := newTestServer(t)
+	ts.engine.GET("test/csrf", func(c *gin.Context) {
+		c.String(http.StatusOK, getCSRFToken(c))
+	})
+	ts.engine.POST("test/csrf", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return ts
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	ts := newCSRFTestServer(t)
+
+	// a safe method passes and hands out the token of the session
+	w := ts.do(httptest.NewRequest(http.MethodGet, "/test/csrf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	token := w.Body.String()
+	require.NotEmpty(t, token)
+	cookies := w.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	post := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/test/csrf", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	w = ts.do(post(""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req := post("")
+	req.Header.Set(CSRFHeader, "wrong")
+	w = ts.do(req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req = post("")
+	req.Header.Set(CSRFHeader, token)
+	w = ts.do(req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = ts.do(post(url.Values{CSRFFormField: {token}}.Encode()))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestCSRFMiddleware_NonBrowserClient(t *testing.T) {
+	ts := newCSRFTestServer(t)
+
+	tests := []struct {
+		name       string
+		cert       string
+		nonBrowser bool
+		want       int
+	}{
+		{"anonymous", "", true, http.StatusForbidden},
+		{"untrusted certificate", ts.clientCert(t, "mallory", true), true, http.StatusForbidden},
+		{"verified certificate", ts.clientCert(t, "alice", false), true, http.StatusNoContent},
+		// browsers present client certificates on cross-site requests too
+		{"without header", ts.clientCert(t, "alice", false), false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/test/csrf", nil)
+			if tt.cert != "" {
+				req.Header.Set("X-Client-Cert", tt.cert)
+			}
+			if tt.nonBrowser {
+				req.Header.Set(NonBrowserHeader, "XMLHttpRequest")
+			}
+
+			w := ts.do(req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 
 	gin "github.com/gin-gonic/gin"
-	logrus "github.com/sirupsen/logrus"
+	errors "github.com/pkg/errors"
 
 	platformsh "github.com/demosdemon/super-potato/pkg/platformsh"
 )
@@ -40,13 +40,14 @@ func (s *Server) registerGeneratedRoutes(r gin.IRoutes) {
 }
 
 func (s *Server) getApplication(c *gin.Context) {
-	logrus.Trace("getApplication")
+	getLogger(c).Trace("getApplication")
 	obj, err := s.Environment.Application()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -54,13 +55,14 @@ func (s *Server) getApplication(c *gin.Context) {
 }
 
 func (s *Server) getApplicationName(c *gin.Context) {
-	logrus.Trace("getApplicationName")
+	getLogger(c).Trace("getApplicationName")
 	obj, err := s.Environment.ApplicationName()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -68,13 +70,14 @@ func (s *Server) getApplicationName(c *gin.Context) {
 }
 
 func (s *Server) getAppCommand(c *gin.Context) {
-	logrus.Trace("getAppCommand")
+	getLogger(c).Trace("getAppCommand")
 	obj, err := s.Environment.AppCommand()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -82,13 +85,14 @@ func (s *Server) getAppCommand(c *gin.Context) {
 }
 
 func (s *Server) getAppDir(c *gin.Context) {
-	logrus.Trace("getAppDir")
+	getLogger(c).Trace("getAppDir")
 	obj, err := s.Environment.AppDir()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -96,13 +100,14 @@ func (s *Server) getAppDir(c *gin.Context) {
 }
 
 func (s *Server) getBranch(c *gin.Context) {
-	logrus.Trace("getBranch")
+	getLogger(c).Trace("getBranch")
 	obj, err := s.Environment.Branch()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -110,13 +115,14 @@ func (s *Server) getBranch(c *gin.Context) {
 }
 
 func (s *Server) getDir(c *gin.Context) {
-	logrus.Trace("getDir")
+	getLogger(c).Trace("getDir")
 	obj, err := s.Environment.Dir()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -124,13 +130,14 @@ func (s *Server) getDir(c *gin.Context) {
 }
 
 func (s *Server) getDocumentRoot(c *gin.Context) {
-	logrus.Trace("getDocumentRoot")
+	getLogger(c).Trace("getDocumentRoot")
 	obj, err := s.Environment.DocumentRoot()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -138,13 +145,14 @@ func (s *Server) getDocumentRoot(c *gin.Context) {
 }
 
 func (s *Server) getEnvironment(c *gin.Context) {
-	logrus.Trace("getEnvironment")
+	getLogger(c).Trace("getEnvironment")
 	obj, err := s.Environment.Environment()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -152,13 +160,14 @@ func (s *Server) getEnvironment(c *gin.Context) {
 }
 
 func (s *Server) getPort(c *gin.Context) {
-	logrus.Trace("getPort")
+	getLogger(c).Trace("getPort")
 	obj, err := s.Environment.Port()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -166,13 +175,14 @@ func (s *Server) getPort(c *gin.Context) {
 }
 
 func (s *Server) getProject(c *gin.Context) {
-	logrus.Trace("getProject")
+	getLogger(c).Trace("getProject")
 	obj, err := s.Environment.Project()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -180,13 +190,14 @@ func (s *Server) getProject(c *gin.Context) {
 }
 
 func (s *Server) getProjectEntropy(c *gin.Context) {
-	logrus.Trace("getProjectEntropy")
+	getLogger(c).Trace("getProjectEntropy")
 	obj, err := s.Environment.ProjectEntropy()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -194,13 +205,14 @@ func (s *Server) getProjectEntropy(c *gin.Context) {
 }
 
 func (s *Server) getRelationships(c *gin.Context) {
-	logrus.Trace("getRelationships")
+	getLogger(c).Trace("getRelationships")
 	obj, err := s.Environment.Relationships()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -208,13 +220,14 @@ func (s *Server) getRelationships(c *gin.Context) {
 }
 
 func (s *Server) getRoutes(c *gin.Context) {
-	logrus.Trace("getRoutes")
+	getLogger(c).Trace("getRoutes")
 	obj, err := s.Environment.Routes()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -222,13 +235,14 @@ func (s *Server) getRoutes(c *gin.Context) {
 }
 
 func (s *Server) getSMTPHost(c *gin.Context) {
-	logrus.Trace("getSMTPHost")
+	getLogger(c).Trace("getSMTPHost")
 	obj, err := s.Environment.SMTPHost()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -236,13 +250,14 @@ func (s *Server) getSMTPHost(c *gin.Context) {
 }
 
 func (s *Server) getSocket(c *gin.Context) {
-	logrus.Trace("getSocket")
+	getLogger(c).Trace("getSocket")
 	obj, err := s.Environment.Socket()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -250,13 +265,14 @@ func (s *Server) getSocket(c *gin.Context) {
 }
 
 func (s *Server) getTreeID(c *gin.Context) {
-	logrus.Trace("getTreeID")
+	getLogger(c).Trace("getTreeID")
 	obj, err := s.Environment.TreeID()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -264,13 +280,14 @@ func (s *Server) getTreeID(c *gin.Context) {
 }
 
 func (s *Server) getVariables(c *gin.Context) {
-	logrus.Trace("getVariables")
+	getLogger(c).Trace("getVariables")
 	obj, err := s.Environment.Variables()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -278,13 +295,14 @@ func (s *Server) getVariables(c *gin.Context) {
 }
 
 func (s *Server) getXClientCert(c *gin.Context) {
-	logrus.Trace("getXClientCert")
+	getLogger(c).Trace("getXClientCert")
 	obj, err := s.Environment.XClientCert()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -292,13 +310,14 @@ func (s *Server) getXClientCert(c *gin.Context) {
 }
 
 func (s *Server) getXClientDN(c *gin.Context) {
-	logrus.Trace("getXClientDN")
+	getLogger(c).Trace("getXClientDN")
 	obj, err := s.Environment.XClientDN()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -306,13 +325,14 @@ func (s *Server) getXClientDN(c *gin.Context) {
 }
 
 func (s *Server) getXClientIP(c *gin.Context) {
-	logrus.Trace("getXClientIP")
+	getLogger(c).Trace("getXClientIP")
 	obj, err := s.Environment.XClientIP()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -320,13 +340,14 @@ func (s *Server) getXClientIP(c *gin.Context) {
 }
 
 func (s *Server) getXClientSSL(c *gin.Context) {
-	logrus.Trace("getXClientSSL")
+	getLogger(c).Trace("getXClientSSL")
 	obj, err := s.Environment.XClientSSL()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -334,13 +355,14 @@ func (s *Server) getXClientSSL(c *gin.Context) {
 }
 
 func (s *Server) getXClientVerify(c *gin.Context) {
-	logrus.Trace("getXClientVerify")
+	getLogger(c).Trace("getXClientVerify")
 	obj, err := s.Environment.XClientVerify()
-	_, ok := err.(platformsh.MissingEnvironment)
 	switch {
 	case err == nil:
 		s.negotiate(c, http.StatusOK, obj)
-	case ok:
+	case errors.As(err, new(platformsh.DecodeError)):
+		s.negotiate(c, http.StatusInternalServerError, err)
+	case errors.As(err, new(platformsh.MissingEnvironment)):
 		s.negotiate(c, http.StatusNotFound, err)
 	default:
 		s.negotiate(c, http.StatusInternalServerError, err)
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CSPNonceKey = "super-potato/pkg/server/CSPNonce"
+
+	// the max-age used by the Platform.sh router
+	hstsMaxAge = 365 * 24 * 60 * 60
+)
+
+// HeaderPolicy holds the security headers of a route group. {nonce} in the
+// content security policy is replaced with the nonce of the request, which
+// the HTML templates put on their scripts and styles.
+type HeaderPolicy struct {
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	FrameOptions          string
+}
+
+var (
+	// strictHeaders is the default; it allows the pretty HTML view and
+	// nothing else.
+	strictHeaders = HeaderPolicy{
+		ContentSecurityPolicy: "default-src 'none'; script-src 'nonce-{nonce}'; style-src 'nonce-{nonce}'; img-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'",
+		ReferrerPolicy:        "no-referrer",
+		FrameOptions:          "DENY",
+	}
+
+	// documentHeaders suits the Markdown pages, which may embed images from
+	// anywhere and post forms.
+	documentHeaders = HeaderPolicy{
+		ContentSecurityPolicy: "default-src 'none'; script-src 'nonce-{nonce}'; style-src 'nonce-{nonce}'; img-src * data:; base-uri 'none'; form-action 'self'; frame-ancestors 'none'",
+		ReferrerPolicy:        "same-origin",
+		FrameOptions:          "DENY",
+	}
+)
+
+func getCSPNonce(c *gin.Context) string {
+	return c.GetString(CSPNonceKey)
+}
+
+// securityHeadersMiddleware sets the headers of strictHeaders, which route
+// groups may replace with securityHeaders, and HSTS as configured for the
+// matched route.
+func (s *Server) securityHeadersMiddleware(c *gin.Context) {
+	c.Set(CSPNonceKey, newNonce())
+	c.Header("X-Content-Type-Options", "nosniff")
+	if v := s.strictTransportSecurity(c); v != "" {
+		c.Header("Strict-Transport-Security", v)
+	}
+	setHeaderPolicy(c, strictHeaders)
+	c.Next()
+}
+
+func (s *Server) securityHeaders(p HeaderPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setHeaderPolicy(c, p)
+		c.Next()
+	}
+}
+
+func setHeaderPolicy(c *gin.Context, p HeaderPolicy) {
+	c.Header("Content-Security-Policy", strings.Replace(p.ContentSecurityPolicy, "{nonce}", getCSPNonce(c), -1))
+	c.Header("Referrer-Policy", p.ReferrerPolicy)
+	c.Header("X-Frame-Options", p.FrameOptions)
+}
+
+// strictTransportSecurity is only sent over HTTPS, as browsers ignore it
+// otherwise.
+func (s *Server) strictTransportSecurity(c *gin.Context) string {
+	match, ok := getRouteMatch(c)
+	if !ok || s.requestURL(c.Request).Scheme != "https" {
+		return ""
+	}
+
+	sts := match.Route.TLS.StrictTransportSecurity
+	if !sts.Enabled {
+		return ""
+	}
+
+	rv := "max-age=" + strconv.Itoa(hstsMaxAge)
+	if sts.IncludeSubdomains {
+		rv += "; includeSubDomains"
+	}
+	if sts.Preload {
+		rv += "; preload"
+	}
+	return rv
+}
+
+func newNonce() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return base64.StdEncoding.EncodeToString(buf[:])
+}
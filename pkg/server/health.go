@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+
+	// certificates expiring sooner than this are reported as a warning
+	certificateExpiryWarning = 30 * 24 * time.Hour
+	checkTimeout             = 5 * time.Second
+)
+
+type CheckResult struct {
+	Name      string  `json:"name" yaml:"name"`
+	Status    string  `json:"status" yaml:"status"`
+	LatencyMS float64 `json:"latency_ms" yaml:"latency_ms"`
+	Message   string  `json:"message,omitempty" yaml:"message,omitempty"`
+	Error     string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string        `json:"status" yaml:"status"`
+	Ready  *bool         `json:"ready,omitempty" yaml:"ready,omitempty"`
+	Checks []CheckResult `json:"checks" yaml:"checks"`
+}
+
+// check returns a message on success. A warning is returned as a
+// checkWarning error.
+type check struct {
+	name string
+	fn   func(ctx context.Context) (string, error)
+}
+
+type checkWarning string
+
+func (w checkWarning) Error() string {
+	return string(w)
+}
+
+func (s *Server) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+	logrus.WithField("ready", ready).Debug("readiness changed")
+}
+
+func (s *Server) isReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+func (s *Server) checks() []check {
+	return []check{
+		{"database", s.checkDatabase},
+		{"sessions", s.checkSessions},
+		{"signer", s.checkSigner},
+	}
+}
+
+// runChecks runs every check concurrently; each is given checkTimeout.
+func (s *Server) runChecks(ctx context.Context) HealthReport {
+	checks := s.checks()
+	rv := HealthReport{
+		Status: CheckOK,
+		Checks: make([]CheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for idx, chk := range checks {
+		wg.Add(1)
+		go func(idx int, chk check) {
+			defer wg.Done()
+			rv.Checks[idx] = runCheck(ctx, chk)
+		}(idx, chk)
+	}
+	wg.Wait()
+
+	for _, res := range rv.Checks {
+		switch res.Status {
+		case CheckFail:
+			rv.Status = CheckFail
+		case CheckWarn:
+			if rv.Status == CheckOK {
+				rv.Status = CheckWarn
+			}
+		}
+	}
+	return rv
+}
+
+func runCheck(ctx context.Context, chk check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	type result struct {
+		msg string
+		err error
+	}
+
+	start := time.Now()
+	done := make(chan result, 1)
+	go func() {
+		msg, err := chk.fn(ctx)
+		done <- result{msg, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = errors.Wrap(ctx.Err(), "check timed out")
+	}
+
+	rv := CheckResult{
+		Name:      chk.name,
+		Status:    CheckOK,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+		Message:   res.msg,
+	}
+	if w, ok := res.err.(checkWarning); ok {
+		rv.Status = CheckWarn
+		rv.Message = string(w)
+	} else if res.err != nil {
+		rv.Status = CheckFail
+		rv.Error = res.err.Error()
+	}
+	return rv
+}
+
+func (s *Server) checkDatabase(ctx context.Context) (string, error) {
+	s.dbMu.Lock()
+	db := s.db
+	s.dbMu.Unlock()
+
+	if db == nil {
+		return "", errors.New("not connected")
+	}
+	return "", db.PingContext(ctx)
+}
+
+func (s *Server) checkSessions(ctx context.Context) (string, error) {
+	if s.sessionStore.current() == nil {
+		return "", errNoSessionStore
+	}
+
+	backend := s.sessionBackend()
+	if backend != nil {
+		return s.SessionStore + " store", backend.Ping(ctx)
+	}
+	if s.SessionStore != "cookie" {
+		return "", checkWarning("using the cookie store; the " + s.SessionStore + " store is unavailable")
+	}
+	return "cookie store", nil
+}
+
+func (s *Server) checkSigner(context.Context) (string, error) {
+	s.pkiMu.RLock()
+	sign := s.signer
+	ocspSigner := s.ocspSigner
+	s.pkiMu.RUnlock()
+
+	if sign == nil || ocspSigner == nil {
+		return "", errors.New("signer not loaded")
+	}
+
+	certSigner, ok := sign.(interface {
+		Certificate(label, profile string) (*x509.Certificate, error)
+	})
+	if !ok {
+		return "signer available", nil
+	}
+
+	cert, err := certSigner.Certificate("", "")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get intermediate certificate")
+	}
+	return checkExpiry(cert, time.Now())
+}
+
+func checkExpiry(cert *x509.Certificate, now time.Time) (string, error) {
+	remaining := cert.NotAfter.Sub(now)
+	switch {
+	case now.Before(cert.NotBefore):
+		return "", errors.Errorf("intermediate certificate is not valid until %v", cert.NotBefore)
+	case remaining <= 0:
+		return "", errors.Errorf("intermediate certificate expired at %v", cert.NotAfter)
+	case remaining < certificateExpiryWarning:
+		return "", checkWarning("intermediate certificate expires at " + cert.NotAfter.Format(time.RFC3339))
+	default:
+		return "intermediate certificate expires at " + cert.NotAfter.Format(time.RFC3339), nil
+	}
+}
+
+func (s *Server) getLivez(c *gin.Context) {
+	s.negotiate(c, http.StatusOK, gin.H{
+		"status": CheckOK,
+		"uptime": time.Since(s.start).String(),
+	})
+}
+
+func (s *Server) getHealthz(c *gin.Context) {
+	rv := s.runChecks(c.Request.Context())
+	code := http.StatusOK
+	if rv.Status == CheckFail {
+		code = http.StatusServiceUnavailable
+	}
+	s.negotiate(c, code, rv)
+}
+
+// getReadyz fails while the server is starting or draining, as well as when
+// any check fails.
+func (s *Server) getReadyz(c *gin.Context) {
+	ready := s.isReady()
+	rv := s.runChecks(c.Request.Context())
+	rv.Ready = &ready
+
+	code := http.StatusOK
+	if !ready || rv.Status == CheckFail {
+		code = http.StatusServiceUnavailable
+	}
+	s.negotiate(c, code, rv)
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":    tls.NoClientCert,
+	"request": tls.VerifyClientCertIfGiven,
+	"require": tls.RequireAndVerifyClientCert,
+}
+
+// listener is a socket the server accepts connections on. TLS is applied
+// when serving so the raw socket can be handed to a restarted process. Router
+// marks the environment's SOCKET or PORT, which only the Platform.sh router
+// connects to.
+type listener struct {
+	net.Listener
+	TLS    bool
+	Router bool
+}
+
+func (l listener) name() string {
+	switch {
+	case l.TLS:
+		return "tls"
+	case l.Router:
+		return "router"
+	default:
+		return "http"
+	}
+}
+
+// listeners opens every socket the server should serve on. Sockets passed by
+// systemd come first, then each --listen address they don't already cover.
+// When neither is given the environment's SOCKET or PORT is used.
+func (s *Server) listeners() ([]listener, error) {
+	var rv []listener
+	fail := func(err error) ([]listener, error) {
+		for _, l := range rv {
+			_ = l.Close()
+		}
+		return nil, err
+	}
+
+	activated, err := s.SystemdListeners()
+	if err != nil {
+		return fail(err)
+	}
+	for _, l := range activated {
+		rv = append(rv, listener{Listener: l.Listener, TLS: l.Name == "tls", Router: l.Name == "router"})
+	}
+
+	for _, v := range s.Listen {
+		addr, err := platformsh.ParseListenAddress(v)
+		if err != nil {
+			return fail(err)
+		}
+
+		// e.g. inherited from a restart
+		if activatedAddress(activated, addr) {
+			continue
+		}
+
+		l, err := net.Listen(addr.Network, addr.Address)
+		if err != nil {
+			return fail(errors.Wrapf(err, "unable to listen on %v", addr))
+		}
+		rv = append(rv, listener{Listener: l, TLS: addr.TLS})
+	}
+
+	if len(rv) == 0 {
+		l, err := s.Listener()
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, listener{Listener: l, Router: true})
+	}
+
+	for _, l := range rv {
+		if l.TLS && s.currentTLSConfig() == nil {
+			return fail(errors.New("TLS listeners require --tls-cert and --tls-key"))
+		}
+		logrus.WithField("addr", l.Addr()).WithField("tls", l.TLS).Info("listening")
+	}
+	return rv, nil
+}
+
+// activatedAddress reports whether one of the activated sockets listens on
+// addr. A wildcard host matches any unspecified address, i.e. :8080 matches a
+// socket on [::]:8080.
+func activatedAddress(activated []platformsh.NamedListener, addr platformsh.ListenAddress) bool {
+	for _, l := range activated {
+		switch a := l.Addr().(type) {
+		case *net.UnixAddr:
+			if addr.Network == "unix" && a.Name == addr.Address {
+				return true
+			}
+		case *net.TCPAddr:
+			if addr.Network == "unix" {
+				continue
+			}
+			want, err := net.ResolveTCPAddr(addr.Network, addr.Address)
+			if err != nil || want.Port != a.Port {
+				continue
+			}
+			if want.IP == nil || want.IP.IsUnspecified() {
+				if a.IP == nil || a.IP.IsUnspecified() {
+					return true
+				}
+			} else if want.IP.Equal(a.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serverTLSConfig defers to the current configuration for every handshake
+// so that reloaded certificates apply to new connections.
+func (s *Server) serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.currentTLSConfig(), nil
+		},
+	}
+}
+
+// getTLSConfig loads the server certificate from --tls-cert and --tls-key, or
+// returns nil when they aren't set. Client certificates are verified against
+// the root and intermediate CA in the environment.
+func (s *Server) getTLSConfig() (*tls.Config, error) {
+	if s.TLSCert == "" || s.TLSKey == "" {
+		return nil, nil
+	}
+
+	certPem, err := s.readFile(s.TLSCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read TLS certificate")
+	}
+
+	keyPem, err := s.readFile(s.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read TLS private key")
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load TLS key pair")
+	}
+
+	clientAuth, ok := clientAuthTypes[s.ClientAuth]
+	if !ok {
+		return nil, errors.Errorf("unknown client auth %q", s.ClientAuth)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if clientAuth != tls.NoClientCert {
+		config.ClientCAs, err = s.getClientCAs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (s *Server) getClientCAs() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, name := range []string{"PKI_ROOT_CERTIFICATE", "PKI_INTERMEDIATE_CERTIFICATE"} {
+		pem, ok := s.Lookup(name)
+		if !ok {
+			return nil, errors.Errorf("%s not found in environment", name)
+		}
+		if !pool.AppendCertsFromPEM([]byte(pem)) {
+			return nil, errors.Errorf("failed adding %s to pool", name)
+		}
+	}
+	return pool, nil
+}
+
+func (s *Server) readFile(path string) ([]byte, error) {
+	fp, err := s.GetInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ioutil.ReadAll(fp)
+}
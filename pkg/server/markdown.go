@@ -2,9 +2,11 @@ package server
 
 import (
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 
 	"github.com/russross/blackfriday/v2"
 )
@@ -13,8 +15,9 @@ const prettyHTMLTemplate = `<!DOCTYPE html>
 <html>
 <head>
 	<meta charset="utf-8">
+	<meta name="csrf-token" content="%[1]s">
 	<title>Result</title>
-	<style>
+	<style nonce="%[2]s">
 		html {
 			font-family: "Helvetica Neue", Helvetica, Arial, sans-serif;
 			font-weight: 300;
@@ -36,18 +39,26 @@ const prettyHTMLTemplate = `<!DOCTYPE html>
 			height: 100px;
 		}
 	</style>
-	<link rel="stylesheet" href="//cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/styles/default.min.css">
+	<link rel="stylesheet" nonce="%[2]s" href="//cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/styles/default.min.css">
 </head>
 <body>
 	<img class="logo" src="/logo.svg?background=%%23ccc&foreground=%%23eee" alt="">
-	<div class="markdown">%s</div>
-	<script src="//cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/highlight.min.js"></script>
-	<script>hljs.initHighlighting();</script>
+	<div class="markdown">%[3]s</div>
+	<script nonce="%[2]s" src="//cdnjs.cloudflare.com/ajax/libs/highlight.js/9.15.6/highlight.min.js"></script>
+	<script nonce="%[2]s">hljs.initHighlighting();</script>
 </body>
 </html>
 `
 
+// postForm matches the opening tag of a form that is posted.
+var postForm = regexp.MustCompile(`(?i)<form\b[^>]*\bmethod\s*=\s*["']?post\b[^>]*>`)
+
 type Markdown struct {
+	// CSRFToken is added to the page and to every form that is posted.
+	CSRFToken string
+	// Nonce is put on the scripts and styles of the page, see HeaderPolicy.
+	Nonce string
+
 	input io.Reader
 }
 
@@ -66,13 +77,20 @@ func (m *Markdown) Render(w http.ResponseWriter) error {
 		return err
 	}
 
-	html := blackfriday.Run(md, blackfriday.WithExtensions(extensions))
-	_, err = fmt.Fprintf(w, prettyHTMLTemplate, string(html))
+	out := blackfriday.Run(md, blackfriday.WithExtensions(extensions))
+	token := html.EscapeString(m.CSRFToken)
+	if token != "" {
+		field := []byte(`<input type="hidden" name="` + CSRFFormField + `" value="` + token + `">`)
+		out = postForm.ReplaceAllFunc(out, func(tag []byte) []byte {
+			return append(append([]byte(nil), tag...), field...)
+		})
+	}
+
+	_, err = fmt.Fprintf(w, prettyHTMLTemplate, token, html.EscapeString(m.Nonce), string(out))
 	return err
 }
 
 func (m *Markdown) WriteContentType(w http.ResponseWriter) {
-	w.Header().Set("Content-Security-Policy", "img-src *")
 	if v, ok := w.Header()["Content-Type"]; ok && len(v) > 0 {
 		return
 	}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"github.com/demosdemon/super-potato/pkg/metrics"
+)
+
+// unmatchedRoute labels requests that didn't match a route, so that
+// arbitrary paths don't create new series.
+const unmatchedRoute = "unmatched"
+
+type serverMetrics struct {
+	registry      *metrics.Registry
+	requests      *metrics.Counter
+	latency       *metrics.Histogram
+	sessions      *metrics.Counter
+	certsIssued   *metrics.Counter
+	certsRevoked  *metrics.Counter
+	ocspResponses *metrics.Counter
+	rateLimited   *metrics.Counter
+}
+
+func (s *Server) newMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:      r,
+		requests:      r.NewCounter("http_requests_total", "HTTP requests served.", "method", "route", "code"),
+		latency:       r.NewHistogram("http_request_duration_seconds", "HTTP request latency.", metrics.DefaultBuckets, "method", "route"),
+		sessions:      r.NewCounter("sessions_created_total", "Sessions started."),
+		certsIssued:   r.NewCounter("pki_certificates_issued_total", "Certificates recorded by the signer."),
+		certsRevoked:  r.NewCounter("pki_certificates_revoked_total", "Certificates revoked."),
+		ocspResponses: r.NewCounter("pki_ocsp_responses_total", "OCSP responses signed.", "status"),
+		rateLimited:   r.NewCounter("http_rate_limited_total", "Requests rejected by a rate limit.", "group"),
+	}
+
+	r.NewGaugeFunc("process_start_time_seconds", "When the server started.", func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(s.start.Unix())}}
+	})
+	r.NewGaugeFunc("server_ready", "Whether /readyz reports ready.", func() []metrics.Sample {
+		var v float64
+		if s.isReady() {
+			v = 1
+		}
+		return []metrics.Sample{{Value: v}}
+	})
+	r.NewGaugeFunc("go_goroutines", "Goroutines that currently exist.", func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(runtime.NumGoroutine())}}
+	})
+	r.NewGaugeFunc("go_memstats", "Go memory statistics, see runtime.MemStats.", memStats, "stat")
+	r.NewGaugeFunc("db_pool", "Database connection pool statistics, see sql.DBStats.", s.dbStats, "stat")
+	return m
+}
+
+func memStats() []metrics.Sample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return []metrics.Sample{
+		stat("alloc_bytes", float64(m.Alloc)),
+		stat("total_alloc_bytes", float64(m.TotalAlloc)),
+		stat("sys_bytes", float64(m.Sys)),
+		stat("heap_objects", float64(m.HeapObjects)),
+		stat("num_gc", float64(m.NumGC)),
+	}
+}
+
+func stat(name string, v float64) metrics.Sample {
+	return metrics.Sample{LabelValues: []string{name}, Value: v}
+}
+
+func (s *Server) dbStats() []metrics.Sample {
+	s.dbMu.Lock()
+	db := s.db
+	s.dbMu.Unlock()
+	if db == nil {
+		return nil
+	}
+
+	stats := db.Stats()
+	return []metrics.Sample{
+		stat("max_open", float64(stats.MaxOpenConnections)),
+		stat("open", float64(stats.OpenConnections)),
+		stat("in_use", float64(stats.InUse)),
+		stat("idle", float64(stats.Idle)),
+		stat("wait_count", float64(stats.WaitCount)),
+		stat("wait_seconds", stats.WaitDuration.Seconds()),
+	}
+}
+
+// indexRoutes maps each route's handler to its path since gin doesn't tell
+// a middleware which route matched.
+func (s *Server) indexRoutes() {
+	s.routes = make(map[string]string)
+	for _, route := range s.engine.Routes() {
+		s.routes[route.Method+" "+route.Handler] = route.Path
+	}
+}
+
+func (s *Server) routeLabel(c *gin.Context) string {
+	if path, ok := s.routes[c.Request.Method+" "+c.HandlerName()]; ok {
+		return path
+	}
+	return unmatchedRoute
+}
+
+func (s *Server) metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := s.routeLabel(c)
+	code := strconv.Itoa(c.Writer.Status())
+	s.metrics.requests.Inc(c.Request.Method, route, code)
+	s.metrics.latency.Observe(time.Since(start).Seconds(), c.Request.Method, route)
+}
+
+func (s *Server) getMetrics(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := s.metrics.registry.WriteText(&buf); err != nil {
+		getLogger(c).WithError(err).Error("unable to write metrics")
+		abortWithError(c, err)
+		return
+	}
+
+	c.Render(http.StatusOK, render.Data{
+		ContentType: metrics.ContentType,
+		Data:        buf.Bytes(),
+	})
+}
+
+// meteredAccessor counts certificates as the signer records them.
+type meteredAccessor struct {
+	certdb.Accessor
+	metrics *serverMetrics
+}
+
+func (a meteredAccessor) InsertCertificate(cr certdb.CertificateRecord) error {
+	err := a.Accessor.InsertCertificate(cr)
+	if err == nil {
+		a.metrics.certsIssued.Inc()
+	}
+	return err
+}
+
+func (a meteredAccessor) RevokeCertificate(serial, aki string, reasonCode int) error {
+	err := a.Accessor.RevokeCertificate(serial, aki, reasonCode)
+	if err == nil {
+		a.metrics.certsRevoked.Inc()
+	}
+	return err
+}
+
+type meteredOCSPSigner struct {
+	ocsp.Signer
+	metrics *serverMetrics
+}
+
+func (o meteredOCSPSigner) Sign(req ocsp.SignRequest) ([]byte, error) {
+	rv, err := o.Signer.Sign(req)
+	if err == nil {
+		o.metrics.ocspResponses.Inc(req.Status)
+	}
+	return rv, err
+}
@@ -7,10 +7,16 @@ import (
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/pki"
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
 )
 
-const UserCacheKey = "super-potato/pkg/server/CertifiedUser"
+const (
+	UserCacheKey = "super-potato/pkg/server/CertifiedUser"
+	// set when the session was created by this request
+	SessionNewKey = "super-potato/pkg/server/SessionNew"
+)
 
 func getUser(c *gin.Context) User {
 	if u, ok := c.Get(UserCacheKey); ok {
@@ -24,21 +30,47 @@ func getUser(c *gin.Context) User {
 func (s *Server) register(r gin.IRouter) {
 	r.Use(
 		// order is important
-		gin.Logger(),
-		gin.Recovery(),
-		sessions.Sessions(s.SessionCookie, s.GetSessionStore()),
+		s.requestIDMiddleware,
+		s.tracingMiddleware,
+		s.accessLogMiddleware,
+		s.metricsMiddleware,
+		s.recoveryMiddleware,
+		s.errorMiddleware,
+		s.routeMiddleware,
+		s.securityHeadersMiddleware,
+		s.httpAccessMiddleware,
+		s.redirectMiddleware,
+		sessions.Sessions(s.SessionCookie, s.sessionStore),
 		s.certifiedUserMiddleware,
+		s.csrfMiddleware,
 		s.sessionDuration,
+		s.handlerSpanMiddleware,
 	)
 
-	r.GET("", s.root)
+	// probes are never rate limited
 	r.GET("ping", s.getPing)
-	r.GET("user", s.getUser)
-	r.GET("debug/vars", s.requireAuth, s.getDebugVars)
-	r.GET("favicon.ico", s.serverLifetime, s.getFaviconICO)
-	r.GET("logo.svg", s.cacheControl, s.getLogoSVG)
-	r.GET("logo.png", s.serverLifetime, s.getLogoPNG)
-	s.registerGeneratedRoutes(r.Group("env", s.requireAuth))
+	r.GET("health", s.getHealth)
+	r.GET("livez", s.getLivez)
+	r.GET("healthz", s.getHealthz)
+	r.GET("readyz", s.getReadyz)
+
+	public := r.Group("", s.rateLimit("public"), s.securityHeaders(documentHeaders))
+	public.GET("", s.root)
+	public.GET("user", s.getUser)
+	public.GET("debug/vars", s.requireAuth, s.getDebugVars)
+	public.GET("metrics", s.requireAuth, s.getMetrics)
+	public.GET("favicon.ico", s.serverLifetime, s.getFaviconICO)
+	public.GET("logo.svg", s.cacheControl, s.getLogoSVG)
+	public.GET("logo.png", s.serverLifetime, s.getLogoPNG)
+
+	s.registerGeneratedRoutes(r.Group("env", s.rateLimit("env"), s.requireAuth))
+
+	own := r.Group("sessions", s.rateLimit("sessions"), s.requireAuth)
+	own.GET("", s.getSessions)
+	own.DELETE(":id", s.deleteSession)
+
+	admin := r.Group("admin", s.rateLimit("admin"), s.requireAuth, s.requireAdmin)
+	admin.DELETE("sessions", s.deleteOwnerSessions)
 }
 
 func (s *Server) certifiedUserMiddleware(c *gin.Context) {
@@ -48,6 +80,23 @@ func (s *Server) certifiedUserMiddleware(c *gin.Context) {
 		return
 	}
 
+	// verified by the TLS listener against the client CAs
+	if state := c.Request.TLS; state != nil && len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		c.Set(UserCacheKey, &CertifiedUser{
+			ClientCertificate: pki.Certificate{Certificate: cert},
+			DistinguishedName: cert.Subject.String(),
+			Verified:          len(state.VerifiedChains) > 0,
+		})
+		return
+	}
+
+	// anyone can send the headers; only the Platform.sh router and trusted
+	// proxies strip and set them
+	if !s.fromTrustedProxy(c.Request) {
+		return
+	}
+
 	xClientCert := c.GetHeader("X-Client-Cert")
 	if xClientCert == "" {
 		xClientCert, _ = s.XClientCert()
@@ -58,17 +107,17 @@ func (s *Server) certifiedUserMiddleware(c *gin.Context) {
 
 	var user CertifiedUser
 	if err := user.ClientCertificate.UnmarshalText([]byte(xClientCert)); err != nil {
-		logrus.WithError(err).WithField("xClientCert", xClientCert).Error("unable to decode certificate")
+		getLogger(c).WithError(err).WithField("xClientCert", xClientCert).Error("unable to decode certificate")
 		return
 	}
 
-	user.DistinguishedName = c.GetHeader("X-Client-Dn")
-	if user.DistinguishedName == "" {
-		user.DistinguishedName, _ = s.XClientDN()
-		if user.DistinguishedName == "" {
-			user.DistinguishedName = user.ClientCertificate.Subject.String()
-		}
+	// the DN is taken from the verified certificate, never from X-Client-Dn
+	if err := s.verifyClientCertificate(user.ClientCertificate.Certificate); err != nil {
+		getLogger(c).WithError(err).WithField("subject", user.ClientCertificate.Subject.String()).Warn("untrusted client certificate")
+		return
 	}
+	user.DistinguishedName = user.ClientCertificate.Subject.String()
+	user.Verified = true
 
 	c.Set(UserCacheKey, &user)
 }
@@ -78,17 +127,28 @@ func (s *Server) sessionDuration(c *gin.Context) {
 
 	ts, _ := session.Get("ts").(string)
 	if ts == "" {
+		s.metrics.sessions.Inc()
 		ts = time.Now().Format(time.RFC3339Nano)
 		session.Set("ts", ts)
 	}
 	start, _ := time.Parse(time.RFC3339Nano, ts)
 
+	if id, _ := session.Get(sessionstore.IDKey).(string); id == "" {
+		session.Set(sessionstore.IDKey, newRequestID())
+		c.Set(SessionNewKey, true)
+	}
+	if u := getUser(c); u.Authenticated() {
+		session.Set(sessionstore.OwnerKey, u.UserName())
+	}
+	session.Set(sessionstore.UserAgentKey, c.Request.UserAgent())
+	session.Set(sessionstore.ClientIPKey, s.clientIP(c))
+
 	count, _ := session.Get("count").(int)
 	count += 1
 	session.Set("count", count)
 	err := session.Save()
 	if err != nil {
-		logrus.WithError(err).Warn("unable to save session")
+		getLogger(c).WithError(err).Warn("unable to save session")
 	}
 
 	elapsed := time.Now().Sub(start)
@@ -96,6 +156,7 @@ func (s *Server) sessionDuration(c *gin.Context) {
 		c.Header("X-Session-Duration", fmt.Sprintf("%v", elapsed))
 	}
 
+	c.Set(SessionCountKey, count)
 	c.Header("X-Session-Count", fmt.Sprintf("%d", count))
 	c.Header("X-Session-Start", start.Format(time.RFC1123))
 	c.Next()
@@ -103,11 +164,19 @@ func (s *Server) sessionDuration(c *gin.Context) {
 
 func (s *Server) requireAuth(c *gin.Context) {
 	if !getUser(c).Authenticated() {
-		s.negotiate(c, http.StatusUnauthorized, gin.H{
-			"message": "not logged in",
-			"headers": Header{c.Request.Header},
-		})
+		s.problem(c, NewProblem(http.StatusUnauthorized, "not logged in"))
 		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) requireAdmin(c *gin.Context) {
+	u, ok := getUser(c).(*CertifiedUser)
+	if !ok || !u.Authenticated() || !s.Admins.Contains(u.DistinguishedName) {
+		s.problem(c, NewProblem(http.StatusForbidden, "administrators only"))
+		c.Abort()
+		return
 	}
 	c.Next()
 }
@@ -117,7 +186,8 @@ func (s *Server) serverLifetime(c *gin.Context) {
 	case "GET", "HEAD":
 		// hurray!
 	default:
-		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		s.problem(c, NewProblem(http.StatusMethodNotAllowed, c.Request.Method+" is not allowed"))
+		c.Abort()
 		return
 	}
 
@@ -131,7 +201,7 @@ func (s *Server) serverLifetime(c *gin.Context) {
 				c.Header("X-Cache", "MISS")
 			}
 		} else {
-			logrus.WithField("If-Modified-Since", ifModifiedSince).Warn("invalid If-Modified-Since header")
+			getLogger(c).WithField("If-Modified-Since", ifModifiedSince).Warn("invalid If-Modified-Since header")
 		}
 	}
 
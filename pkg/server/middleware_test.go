@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
+)
+
+// request sends the headers of a certificate user behind the router; cert
+// may be empty for an anonymous request.
+func (ts *testServer) request(method, target, cert string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	if cert != "" {
+		req.Header.Set("X-Client-Cert", cert)
+	}
+	// not a browser, so state-changing requests need no CSRF token
+	req.Header.Set(NonBrowserHeader, "test")
+	return req
+}
+
+func TestCertifiedUserMiddleware(t *testing.T) {
+	ts := newTestServer(t)
+	ts.Admins = DNList{testDN("admin")}
+
+	userName := func(req *http.Request) string {
+		w := ts.do(req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			User struct {
+				DistinguishedName string
+				Verified          bool
+			} `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.User.DistinguishedName
+	}
+
+	alice := ts.clientCert(t, "alice", false)
+	assert.Equal(t, testDN("alice"), userName(ts.request(http.MethodGet, "/user", alice)))
+
+	// a certificate that doesn't chain to the client CAs
+	untrusted := ts.clientCert(t, "alice", true)
+	assert.Empty(t, userName(ts.request(http.MethodGet, "/user", untrusted)))
+	w := ts.do(ts.request(http.MethodGet, "/sessions", untrusted))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the headers are only trusted from a proxy
+	req := ts.request(http.MethodGet, "/user", alice)
+	req.RemoteAddr = "198.51.100.7:1234"
+	assert.Empty(t, userName(req))
+
+	// the DN comes from the certificate, never from X-Client-Dn
+	req = ts.request(http.MethodGet, "/user", alice)
+	req.Header.Set("X-Client-Dn", testDN("admin"))
+	assert.Equal(t, testDN("alice"), userName(req))
+
+	req = ts.request(http.MethodDelete, "/admin/sessions?dn=x", alice)
+	req.Header.Set("X-Client-Dn", testDN("admin"))
+	w = ts.do(req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRequireAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	ts.Admins = DNList{testDN("admin")}
+
+	// without a verified certificate the CSRF check rejects the request
+	w := ts.do(ts.request(http.MethodDelete, "/admin/sessions?dn=x", ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = ts.do(ts.request(http.MethodDelete, "/admin/sessions?dn=x", ts.clientCert(t, "alice", false)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = ts.do(ts.request(http.MethodDelete, "/admin/sessions?dn=x", ts.clientCert(t, "admin", true)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = ts.do(ts.request(http.MethodDelete, "/admin/sessions?dn=x", ts.clientCert(t, "admin", false)))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDeleteSession(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, ts.backend.Save(ctx, &sessionstore.Record{ID: "bobs", Owner: testDN("bob"), Expires: expires}))
+	require.NoError(t, ts.backend.Save(ctx, &sessionstore.Record{ID: "alices", Owner: testDN("alice"), Expires: expires}))
+
+	alice := ts.clientCert(t, "alice", false)
+
+	// another owner's session looks like a missing one
+	w := ts.do(ts.request(http.MethodDelete, "/sessions/bobs", alice))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	_, err := ts.backend.Load(ctx, "bobs")
+	assert.NoError(t, err)
+
+	w = ts.do(ts.request(http.MethodDelete, "/sessions/missing", alice))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = ts.do(ts.request(http.MethodDelete, "/sessions/alices", alice))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err = ts.backend.Load(ctx, "alices")
+	assert.Equal(t, sessionstore.ErrNotFound, err)
+
+	w = ts.do(ts.request(http.MethodGet, "/sessions", ""))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
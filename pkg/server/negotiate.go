@@ -26,6 +26,10 @@ type pretty struct {
 	Format string
 	Data   interface{}
 
+	// logger carries the request fields, as rendering happens after the
+	// handler returns.
+	logger *logrus.Entry
+
 	bufMu sync.Mutex
 	buf   io.Reader
 }
@@ -36,14 +40,18 @@ func newPretty(c *gin.Context, code int, data interface{}) *pretty {
 		binding.MIMEYAML,
 	)
 
-	logrus.WithField("format", format).Trace("pretty")
+	logger := getLogger(c)
+	logger.WithField("format", format).Trace("pretty")
 
 	p := pretty{
 		Title:  http.StatusText(code),
 		Format: format,
 		Data:   data,
+		logger: logger,
 	}
 	p.Markdown.input = &p
+	p.Markdown.CSRFToken = getCSRFToken(c)
+	p.Markdown.Nonce = getCSPNonce(c)
 	return &p
 }
 
@@ -56,13 +64,42 @@ func (s *Server) negotiate(c *gin.Context, code int, data interface{}) {
 		binding.MIMEYAML,
 	)
 
+	if err, ok := data.(error); ok && code >= http.StatusBadRequest {
+		s.problem(c, problemFor(err, code))
+		return
+	}
+	if code >= http.StatusBadRequest {
+		data = withRequestID(c, data)
+	}
+
 	renderer := getRenderer(format, data, c, code)
 
 	c.Render(code, renderer)
 }
 
+// withRequestID adds the request ID to an error body so that a user's report
+// can be matched with the logs.
+func withRequestID(c *gin.Context, data interface{}) interface{} {
+	id := getRequestID(c)
+	if id == "" {
+		return data
+	}
+
+	switch v := data.(type) {
+	case gin.H:
+		rv := make(gin.H, len(v)+1)
+		for k, v := range v {
+			rv[k] = v
+		}
+		rv["request_id"] = id
+		return rv
+	default:
+		return data
+	}
+}
+
 func getRenderer(format string, data interface{}, c *gin.Context, code int) render.Render {
-	logrus.WithField("format", format).Trace("getRenderer")
+	getLogger(c).WithField("format", format).Trace("getRenderer")
 
 	switch format {
 	case binding.MIMEJSON:
@@ -74,7 +111,7 @@ func getRenderer(format string, data interface{}, c *gin.Context, code int) rend
 	case binding.MIMEYAML:
 		return render.YAML{Data: data}
 	default:
-		logrus.WithField("format", format).Warn("unknown format")
+		getLogger(c).WithField("format", format).Warn("unknown format")
 		return render.JSON{Data: data}
 	}
 }
@@ -86,7 +123,7 @@ func (p *pretty) Read(buf []byte) (int, error) {
 	if p.buf == nil {
 		r, err := p.render()
 		if err != nil {
-			logrus.WithError(err).Trace()
+			p.logger.WithError(err).Trace("pretty render failed")
 			return 0, err
 		}
 		p.buf = strings.NewReader(r)
@@ -96,7 +133,7 @@ func (p *pretty) Read(buf []byte) (int, error) {
 }
 
 func (p *pretty) render() (string, error) {
-	logrus.Trace("pretty render")
+	p.logger.Trace("pretty render")
 
 	var format string
 	var formatted []byte
@@ -112,7 +149,7 @@ func (p *pretty) render() (string, error) {
 		format = "yaml"
 		formatted, err = yaml.Marshal(p.Data)
 	default:
-		logrus.WithField("format", p.Format).Warn("unknown format")
+		p.logger.WithField("format", p.Format).Warn("unknown format")
 		format = "text"
 		formatted, err = marshalText(p.Data)
 	}
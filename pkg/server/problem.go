@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/pkg/errors"
+
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+const (
+	MIMEProblemJSON = "application/problem+json"
+	MIMEProblemXML  = "application/problem+xml"
+)
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	XMLName   xml.Name `json:"-" yaml:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type      string   `json:"type" yaml:"type" xml:"type"`
+	Title     string   `json:"title" yaml:"title" xml:"title"`
+	Status    int      `json:"status" yaml:"status" xml:"status"`
+	Detail    string   `json:"detail,omitempty" yaml:"detail,omitempty" xml:"detail,omitempty"`
+	Instance  string   `json:"instance,omitempty" yaml:"instance,omitempty" xml:"instance,omitempty"`
+	RequestID string   `json:"request_id,omitempty" yaml:"request_id,omitempty" xml:"request_id,omitempty"`
+	Errors    []string `json:"errors,omitempty" yaml:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// NewProblem returns a problem with the default about:blank type, whose title
+// is the status text.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// problemStatus picks the response status for an error that doesn't carry
+// one. fallback is used when it is an error status.
+func problemStatus(err error, fallback int) int {
+	var p *Problem
+	switch {
+	case errors.As(err, &p):
+		return p.Status
+	case errors.As(err, new(platformsh.DecodeError)):
+		return http.StatusInternalServerError
+	case errors.As(err, new(platformsh.MissingEnvironment)), os.IsNotExist(err):
+		return http.StatusNotFound
+	case fallback >= http.StatusBadRequest:
+		return fallback
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func problemFor(err error, fallback int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		cp := *p
+		return &cp
+	}
+
+	status := problemStatus(err, fallback)
+	detail := err.Error()
+	if status >= http.StatusInternalServerError {
+		// don't leak internals; the request ID leads to the logs
+		detail = ""
+	}
+	return NewProblem(status, detail)
+}
+
+// problem renders p in the negotiated format.
+func (s *Server) problem(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.RequestURI()
+	}
+	p.RequestID = getRequestID(c)
+
+	format := c.NegotiateFormat(
+		MIMEProblemJSON,
+		binding.MIMEJSON,
+		binding.MIMEHTML,
+		MIMEProblemXML,
+		binding.MIMEXML,
+		binding.MIMEXML2,
+		binding.MIMEYAML,
+	)
+
+	var r render.Render
+	switch format {
+	case binding.MIMEHTML:
+		r = newPretty(c, p.Status, p)
+	case MIMEProblemXML, binding.MIMEXML, binding.MIMEXML2:
+		r = problemRender{p, MIMEProblemXML}
+	case binding.MIMEYAML:
+		r = render.YAML{Data: p}
+	default:
+		r = problemRender{p, MIMEProblemJSON}
+	}
+
+	c.Render(p.Status, r)
+}
+
+type problemRender struct {
+	*Problem
+	contentType string
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+
+	var data []byte
+	var err error
+	if r.contentType == MIMEProblemXML {
+		data, err = xml.MarshalIndent(r.Problem, "", "    ")
+		data = append([]byte(xml.Header), data...)
+	} else {
+		data, err = json.MarshalIndent(r.Problem, "", "    ")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", r.contentType+"; charset=utf-8")
+}
+
+// errorMiddleware renders the errors added with c.Error as a problem unless
+// the handler already wrote a response.
+func (s *Server) errorMiddleware(c *gin.Context) {
+	c.Next()
+
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	last := c.Errors.Last()
+	p := problemFor(last.Err, c.Writer.Status())
+	if len(c.Errors) > 1 && p.Status < http.StatusInternalServerError {
+		p.Errors = c.Errors.Errors()
+	}
+
+	getLogger(c).WithError(last.Err).WithField("status", p.Status).Debug("rendering problem")
+	s.problem(c, p)
+}
+
+// recoveryMiddleware replaces gin.Recovery so that panics are rendered as a
+// problem too.
+func (s *Server) recoveryMiddleware(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			getLogger(c).WithField("panic", r).WithField("stack", string(debug.Stack())).Error("recovered from panic")
+			c.Abort()
+			if !c.Writer.Written() {
+				s.problem(c, NewProblem(http.StatusInternalServerError, ""))
+			}
+		}
+	}()
+	c.Next()
+}
+
+// abortWithError aborts the request with err, which errorMiddleware renders.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func (s *Server) notFound(c *gin.Context) {
+	s.problem(c, NewProblem(http.StatusNotFound, "no route for "+c.Request.URL.Path))
+}
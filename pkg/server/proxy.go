@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+// servingListener returns the listener that accepted the connection of the
+// request being served with ctx.
+func servingListener(ctx context.Context) (listener, bool) {
+	l, ok := ctx.Value(listenerContextKey).(listener)
+	return l, ok
+}
+
+// parseNetworks parses the --trusted-proxy addresses and CIDRs.
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	rv := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		network, err := platformsh.AccessAddress{Address: strings.TrimSpace(v)}.Network()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid trusted proxy")
+		}
+		rv = append(rv, network)
+	}
+	return rv, nil
+}
+
+func (s *Server) trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether the forwarding and client certificate
+// headers of r were set by a proxy rather than the client: the request came
+// through the Platform.sh router or from a --trusted-proxy address. Requests
+// on TLS listeners come straight from clients.
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	if r.TLS != nil {
+		return false
+	}
+	if l, ok := servingListener(r.Context()); ok && l.Router {
+		return true
+	}
+	return s.trustedProxy(remoteIP(r))
+}
+
+// clientIP is the address of the peer, or the address a trusted proxy
+// forwarded the request for. Unlike gin's ClientIP, forwarding headers from
+// anyone else are ignored.
+func (s *Server) clientIP(c *gin.Context) string {
+	if s.fromTrustedProxy(c.Request) {
+		// proxies append to X-Forwarded-For; the last address not added by a
+		// trusted proxy is the client
+		hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+		for idx := len(hops) - 1; idx >= 0; idx-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[idx]))
+			if ip == nil {
+				break
+			}
+			if !s.trustedProxy(ip) || idx == 0 {
+				return ip.String()
+			}
+		}
+
+		if ip := net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-Ip"))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	if ip := remoteIP(c.Request); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// remoteIP is nil for unix sockets.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/ratelimit"
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
+)
+
+// What a rate limit bucket is keyed by. The certificate DN and the session
+// fall back to the client IP when the request has no verified certificate or
+// no session from an earlier request.
+const (
+	rateLimitByIP      = "ip"
+	rateLimitByDN      = "dn"
+	rateLimitBySession = "session"
+)
+
+// rateLimitGroups are the route groups that can be limited, see register.
+var rateLimitGroups = map[string]bool{
+	"public":   true,
+	"env":      true,
+	"sessions": true,
+	"admin":    true,
+}
+
+type rateLimitRule struct {
+	limit ratelimit.Limit
+	key   string
+}
+
+// parseRateLimits parses GROUP=N/UNIT[:BURST][:KEY], e.g. env=10/s:20:dn.
+func parseRateLimits(specs []string) (map[string]rateLimitRule, error) {
+	rv := make(map[string]rateLimitRule, len(specs))
+	for _, spec := range specs {
+		idx := strings.IndexByte(spec, '=')
+		if idx <= 0 {
+			return nil, errors.Errorf("invalid rate limit %q: expected GROUP=N/UNIT[:BURST][:KEY]", spec)
+		}
+
+		group, value := spec[:idx], spec[idx+1:]
+		if !rateLimitGroups[group] {
+			return nil, errors.Errorf("invalid rate limit %q: unknown group %q", spec, group)
+		}
+		if _, ok := rv[group]; ok {
+			return nil, errors.Errorf("invalid rate limit %q: %s is limited more than once", spec, group)
+		}
+
+		rule := rateLimitRule{key: rateLimitByIP}
+		if idx := strings.LastIndexByte(value, ':'); idx >= 0 {
+			switch key := value[idx+1:]; key {
+			case rateLimitByIP, rateLimitByDN, rateLimitBySession:
+				rule.key = key
+				value = value[:idx]
+			}
+		}
+
+		var err error
+		rule.limit, err = ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rate limit for %s", group)
+		}
+		rv[group] = rule
+	}
+	return rv, nil
+}
+
+func (s *Server) getRateLimitStore() ratelimit.Store {
+	switch s.RateLimitStore {
+	case "memory", "":
+	case "mongo":
+		return ratelimit.NewMongoStore(func() (*mgo.Collection, error) {
+			db, err := s.connections.MongoDB("sessions")
+			if err != nil {
+				return nil, err
+			}
+			return db.C("ratelimits"), nil
+		})
+	default:
+		logrus.WithField("store", s.RateLimitStore).Warn("unknown rate limit store")
+	}
+
+	logrus.Warn("using in-memory rate limits")
+	return ratelimit.NewMemoryStore()
+}
+
+// rateLimit returns the limiter for a route group; groups without a
+// configured limit are not limited. When the store fails, requests are let
+// through.
+func (s *Server) rateLimit(group string) gin.HandlerFunc {
+	rule, ok := s.rateLimits[group]
+	if !ok {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		key := group + ":" + s.rateLimitKey(c, rule.key)
+		rv, err := s.limiter.Take(key, rule.limit, time.Now())
+		if err != nil {
+			getLogger(c).WithError(err).WithField("group", group).Warn("unable to check rate limit")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(rv.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(rv.Remaining))
+		c.Header("RateLimit-Reset", seconds(rv.Reset))
+		if !rv.Allowed {
+			s.metrics.rateLimited.Inc(group)
+			c.Header("Retry-After", seconds(rv.RetryAfter))
+			s.problem(c, NewProblem(http.StatusTooManyRequests, "rate limit exceeded, retry in "+seconds(rv.RetryAfter)+"s"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (s *Server) rateLimitKey(c *gin.Context, by string) string {
+	switch by {
+	case rateLimitByDN:
+		if u, ok := getUser(c).(*CertifiedUser); ok && u.Authenticated() {
+			return "dn:" + u.DistinguishedName
+		}
+	case rateLimitBySession:
+		// a session minted for this request is no better than none: clients
+		// that drop the cookie get a new one every time
+		if id, _ := sessions.Default(c).Get(sessionstore.IDKey).(string); id != "" && !c.GetBool(SessionNewKey) {
+			return "session:" + id
+		}
+	}
+	return "ip:" + s.clientIP(c)
+}
+
+// seconds rounds up so that clients don't retry too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
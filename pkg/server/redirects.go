@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+)
+
+const RouteMatchCacheKey = "super-potato/pkg/server/RouteMatch"
+
+// requestURL reconstructs the URL the client requested. The forwarding
+// headers set by the Platform.sh router are only honored on requests from a
+// trusted proxy; anyone else could use them to pick the route.
+func (s *Server) requestURL(r *http.Request) *url.URL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if s.fromTrustedProxy(r) {
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			scheme = proto
+		}
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			host = fwd
+		}
+	}
+
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     host,
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	}
+}
+
+func getRouteMatch(c *gin.Context) (platformsh.RouteMatch, bool) {
+	if v, ok := c.Get(RouteMatchCacheKey); ok {
+		if m, ok := v.(platformsh.RouteMatch); ok {
+			return m, true
+		}
+	}
+	return platformsh.RouteMatch{}, false
+}
+
+func (s *Server) routeMiddleware(c *gin.Context) {
+	defer c.Next()
+
+	routes, err := s.Routes()
+	if err != nil {
+		getLogger(c).WithError(err).Trace("no routes found")
+		return
+	}
+
+	if match, ok := routes.Match(s.requestURL(c.Request)); ok {
+		c.Set(RouteMatchCacheKey, match)
+	}
+}
+
+func (s *Server) redirectMiddleware(c *gin.Context) {
+	match, ok := getRouteMatch(c)
+	if !ok || match.Redirect == "" {
+		c.Next()
+		return
+	}
+
+	getLogger(c).WithFields(logrus.Fields{
+		"route":    match.URL.String(),
+		"location": match.Redirect,
+		"code":     match.Code,
+	}).Debug("redirecting")
+
+	if match.Expires > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("max-age=%d", int(match.Expires/time.Second)))
+		c.Header("Expires", time.Now().Add(match.Expires).UTC().Format(http.TimeFormat))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	c.Redirect(match.Code, match.Redirect)
+	c.Abort()
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) currentTLSConfig() *tls.Config {
+	s.pkiMu.RLock()
+	defer s.pkiMu.RUnlock()
+	return s.tlsConfig
+}
+
+func (s *Server) currentClientCAs() *x509.CertPool {
+	s.pkiMu.RLock()
+	defer s.pkiMu.RUnlock()
+	return s.clientCAs
+}
+
+// verifyClientCertificate checks a certificate that a proxy passed in a
+// header the same way TLS listeners check peer certificates.
+func (s *Server) verifyClientCertificate(cert *x509.Certificate) error {
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     s.currentClientCAs(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// loadPKI builds the signers and TLS configuration from the environment. The
+// current values are only replaced when everything loads.
+func (s *Server) loadPKI() error {
+	sign, err := s.getSigner()
+	if err != nil {
+		return errors.Wrap(err, "unable to get certificate signer")
+	}
+	sign.SetDBAccessor(meteredAccessor{s.accessor, s.metrics})
+
+	ocspSigner, err := s.getOCSPSigner()
+	if err != nil {
+		return errors.Wrap(err, "unable to get OCSP signer")
+	}
+
+	tlsConfig, err := s.getTLSConfig()
+	if err != nil {
+		return errors.Wrap(err, "unable to get TLS configuration")
+	}
+
+	clientCAs, err := s.getClientCAs()
+	if err != nil {
+		return errors.Wrap(err, "unable to get client CAs")
+	}
+
+	s.pkiMu.Lock()
+	defer s.pkiMu.Unlock()
+	s.signer = sign
+	s.ocspSigner = meteredOCSPSigner{ocspSigner, s.metrics}
+	s.tlsConfig = tlsConfig
+	s.clientCAs = clientCAs
+	return nil
+}
+
+// Reload re-reads the environment sources and the PKI material. Open
+// connections are not affected; new TLS handshakes use the new certificate.
+func (s *Server) Reload() {
+	logrus.Trace("Server.Reload")
+	s.Environment.Reload()
+	s.reloadSessionStore("SIGHUP", "", true)
+	if err := s.loadPKI(); err != nil {
+		logrus.WithError(err).Error("reload failed; keeping the previous PKI material")
+		return
+	}
+	logrus.Info("reloaded")
+}
+
+func (s *Server) handleSignal(sig os.Signal) {
+	switch sig {
+	case syscall.SIGHUP:
+		s.Reload()
+	case syscall.SIGUSR2:
+		if err := s.restart(); err != nil {
+			logrus.WithError(err).Error("restart failed")
+		}
+	}
+}
+
+// restart starts a new copy of the binary that inherits the listening
+// sockets. Once the child is serving it sends SIGTERM to this process, which
+// then drains in-flight requests and exits.
+//
+// The child starts out as a child of this process. Under systemd it tells
+// the manager that it's the new main process before taking over, otherwise
+// systemd would consider the service stopped and kill it once this process
+// exits; that requires Type=notify and NotifyAccess=all on the unit.
+func (s *Server) restart() error {
+	logrus.Trace("Server.restart")
+
+	s.restartMu.Lock()
+	defer s.restartMu.Unlock()
+
+	if s.child != nil {
+		return errors.Errorf("already restarting as pid %d", s.child.Pid)
+	}
+
+	files := make([]*os.File, 0, len(s.serving))
+	names := make([]string, 0, len(s.serving))
+	defer func() {
+		for _, fp := range files {
+			_ = fp.Close()
+		}
+	}()
+
+	for _, l := range s.serving {
+		fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return errors.Errorf("unable to pass %v to a new process", l.Addr())
+		}
+		fp, err := fl.File()
+		if err != nil {
+			return errors.Wrapf(err, "unable to pass %v to a new process", l.Addr())
+		}
+		files = append(files, fp)
+		names = append(names, l.name())
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(bin, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(
+		listenEnv(os.Environ()),
+		"LISTEN_PPID="+strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+	)
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "unable to start new process")
+	}
+	logrus.WithField("pid", cmd.Process.Pid).Info("started new process")
+
+	// the child's unix sockets must survive this process closing them
+	for _, l := range s.serving {
+		if ul, ok := l.Listener.(interface{ SetUnlinkOnClose(bool) }); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	s.child = cmd.Process
+	go func() {
+		state, err := cmd.Process.Wait()
+		logrus.WithError(err).WithField("state", state).Warn("new process exited")
+
+		s.restartMu.Lock()
+		defer s.restartMu.Unlock()
+		s.child = nil
+		for _, l := range s.serving {
+			if ul, ok := l.Listener.(interface{ SetUnlinkOnClose(bool) }); ok {
+				ul.SetUnlinkOnClose(true)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// listenEnv removes socket activation variables meant for this process.
+func listenEnv(env []string) []string {
+	rv := make([]string, 0, len(env))
+	for _, v := range env {
+		if !strings.HasPrefix(v, "LISTEN_") {
+			rv = append(rv, v)
+		}
+	}
+	return rv
+}
+
+// notifyParent tells the process that handed over its sockets to drain.
+func (s *Server) notifyParent() {
+	ppid, ok := s.Lookup("LISTEN_PPID")
+	if !ok || ppid != strconv.Itoa(os.Getppid()) {
+		return
+	}
+
+	logrus.WithField("pid", ppid).Info("taking over from previous process")
+	if err := s.notifySystemd("MAINPID=" + strconv.Itoa(os.Getpid()) + "\nREADY=1"); err != nil {
+		logrus.WithError(err).Warn("unable to tell systemd about the new main process")
+	}
+	if err := syscall.Kill(os.Getppid(), syscall.SIGTERM); err != nil {
+		logrus.WithError(err).Warn("unable to signal previous process")
+	}
+}
+
+// notifySystemd sends state to the service manager, see sd_notify(3). It does
+// nothing when not run by systemd.
+func (s *Server) notifySystemd(state string) error {
+	socket, ok := s.Lookup("NOTIFY_SOCKET")
+	if !ok || socket == "" {
+		return nil
+	}
+	// abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
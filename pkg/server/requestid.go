@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+	RequestIDKey    = "super-potato/pkg/server/RequestID"
+	LoggerKey       = "super-potato/pkg/server/Logger"
+
+	// longer IDs from clients are replaced
+	maxRequestIDLength = 128
+)
+
+type contextKey int
+
+const (
+	requestIDContextKey contextKey = iota
+	listenerContextKey
+)
+
+// RequestIDFromContext returns the request ID of the request being served
+// with ctx, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+func getRequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// getLogger returns a logrus entry with the request ID of c.
+func getLogger(c *gin.Context) *logrus.Entry {
+	if v, ok := c.Get(LoggerKey); ok {
+		if entry, ok := v.(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// requestIDMiddleware accepts the client's X-Request-ID when it is safe to
+// log, or assigns a new one, and echoes it in the response.
+func (s *Server) requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	c.Set(RequestIDKey, id)
+	c.Set(LoggerKey, logrus.WithField("request_id", id))
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey, id))
+	c.Header(RequestIDHeader, id)
+	c.Next()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '+', r == '/', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
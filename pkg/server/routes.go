@@ -6,7 +6,6 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,16 +17,14 @@ import (
 func (s *Server) root(c *gin.Context) {
 	fp, err := s.Open("/README.md")
 	if err != nil {
-		if os.IsNotExist(err) {
-			c.AbortWithError(404, err)
-		} else {
-			c.AbortWithError(500, err)
-		}
+		abortWithError(c, err)
 		return
 	}
 	defer fp.Close()
 
 	r := NewMarkdown(fp)
+	r.CSRFToken = getCSRFToken(c)
+	r.Nonce = getCSPNonce(c)
 	c.Render(200, r)
 }
 
@@ -35,19 +32,31 @@ func (s *Server) getPing(c *gin.Context) {
 	rv := gin.H{
 		"now":     time.Now(),
 		"query":   c.Request.URL.Query(),
-		"ip":      c.ClientIP(),
+		"ip":      s.clientIP(c),
 		"message": "pong",
 	}
-	logrus.WithFields(logrus.Fields(rv)).Trace("getPing")
+	getLogger(c).WithFields(logrus.Fields(rv)).Trace("getPing")
 
 	s.negotiate(c, http.StatusOK, rv)
 }
 
+func (s *Server) getHealth(c *gin.Context) {
+	code := http.StatusOK
+	if !s.connections.Healthy() {
+		code = http.StatusServiceUnavailable
+	}
+
+	s.negotiate(c, code, gin.H{
+		"healthy":     code == http.StatusOK,
+		"connections": s.connections.Status(),
+	})
+}
+
 func (s *Server) getUser(c *gin.Context) {
 	rv := gin.H{
 		"user": getUser(c),
 	}
-	logrus.WithFields(logrus.Fields(rv)).Trace("getUser")
+	getLogger(c).WithFields(logrus.Fields(rv)).Trace("getUser")
 	s.negotiate(c, http.StatusOK, rv)
 }
 
@@ -66,7 +75,8 @@ func (s *Server) getDebugVars(c *gin.Context) {
 
 	var kvp gin.H
 	if err := json.Unmarshal(buf.Bytes(), &kvp); err != nil {
-		c.AbortWithError(500, err)
+		abortWithError(c, err)
+		return
 	}
 
 	s.negotiate(c, 200, kvp)
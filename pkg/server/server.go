@@ -2,14 +2,18 @@ package server
 
 import (
 	"context"
-	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
+	stdsql "database/sql"
 	"encoding/base32"
+	"net"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/helpers"
@@ -18,33 +22,76 @@ import (
 	"github.com/cloudflare/cfssl/signer/local"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
-	"github.com/gin-contrib/sessions/mongo"
 	"github.com/gin-gonic/gin"
+	"github.com/globalsign/mgo"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/keyring"
 	"github.com/demosdemon/super-potato/pkg/pki"
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+	"github.com/demosdemon/super-potato/pkg/ratelimit"
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
+	"github.com/demosdemon/super-potato/pkg/tracing"
 )
 
-const (
-	OneYear  = 60 * 60 * 24 * 365
-	OneMonth = 60 * 60 * 24 * 30
-)
+// shorter session secrets are guessable
+const minSessionSecret = 32
 
 type Server struct {
-	*app.App      `flag:"-"`
-	SessionCookie string `flag:"session-cookie" desc:"The name of the session cookie." env:"PKI_SESSION_COOKIE"`
-
-	once       sync.Once
-	start      time.Time
-	engine     *gin.Engine
-	db         *sqlx.DB
-	accessor   certdb.Accessor
+	*app.App         `flag:"-"`
+	SessionCookie    string        `flag:"session-cookie" desc:"The name of the session cookie." env:"PKI_SESSION_COOKIE"`
+	SessionStore     string        `flag:"session-store" desc:"Where sessions are kept: mongo (the sessions relationship), postgres (the database relationship), memory or cookie."`
+	SessionTTL       time.Duration `flag:"session-ttl" desc:"How long a session lasts after it was last used."`
+	SessionSecret    string        `flag:"session-secret" desc:"The secret session keys are derived from; defaults to the project entropy." env:"PKI_SESSION_SECRET"`
+	SessionKeys      int           `flag:"session-keys" desc:"How many key generations validate sessions; the newest one is used for new sessions."`
+	Admins           DNList        `flag:"admin" desc:"The certificate DN of an administrator; may be repeated."`
+	HealthInterval   time.Duration `flag:"health-interval" desc:"How often relationship connections are health checked; 0 disables checks."`
+	WatchInterval    time.Duration `flag:"watch-interval" desc:"How often the environment is checked for changes; 0 disables watching."`
+	Listen           []string      `flag:"listen" desc:"An address to listen on, e.g. :8080, [::1]:8080, tls://0.0.0.0:8443 or unix:///run/app.sock; may be repeated."`
+	TLSCert          string        `flag:"tls-cert" desc:"The PEM certificate for TLS listeners."`
+	TLSKey           string        `flag:"tls-key" desc:"The PEM private key for TLS listeners."`
+	ClientAuth       string        `flag:"client-auth" desc:"Client certificate policy for TLS listeners: none, request or require."`
+	DrainTimeout     time.Duration `flag:"drain-timeout" desc:"How long in-flight requests may take to finish when shutting down."`
+	ShutdownDelay    time.Duration `flag:"shutdown-delay" desc:"How long /readyz fails before the listeners close when shutting down."`
+	AccessLogSample  float64       `flag:"access-log-sample" desc:"The fraction of successful requests written to the access log; failed requests are always logged."`
+	AccessLogHeaders []string      `flag:"access-log-header" desc:"A request header to include in the access log; sensitive headers are redacted. May be repeated."`
+	TraceEndpoint    string        `flag:"trace-endpoint" desc:"Where spans are exported: an OTLP/HTTP URL, e.g. http://localhost:4318/v1/traces, or a file (- is stdout); empty disables tracing."`
+	RateLimits       []string      `flag:"rate-limit" desc:"A rate limit for a route group as GROUP=N/s|m|h[:BURST][:ip|dn|session], e.g. env=10/s:20:dn; may be repeated."`
+	TrustedProxies   []string      `flag:"trusted-proxy" desc:"An address or CIDR of a reverse proxy whose forwarding and client certificate headers are trusted; may be repeated. Requests through the Platform.sh router are always trusted."`
+	RateLimitStore   string        `flag:"rate-limit-store" desc:"Where rate limit buckets are kept: memory, or mongo to share them between instances through the sessions relationship."`
+	TempDir          string        `flag:"temp-dir" desc:"A writable directory of the app for private files, e.g. inline relationship certificates, which are removed on shutdown."`
+
+	once         sync.Once
+	start        time.Time
+	ready        int32
+	metrics      *serverMetrics
+	tracer       *tracing.Tracer
+	routes       map[string]string
+	rateLimits   map[string]rateLimitRule
+	proxies      []*net.IPNet
+	limiter      ratelimit.Store
+	keyGen       int64
+	engine       *gin.Engine
+	connections  *platformsh.Connections
+	pemFiles     *platformsh.PEMFiles
+	dbMu         sync.Mutex
+	db           *sqlx.DB
+	accessor     *sql.Accessor
+	sessionStore *reloadableStore
+
+	pkiMu      sync.RWMutex
 	signer     signer.Signer
 	ocspSigner ocsp.Signer
+	tlsConfig  *tls.Config
+	clientCAs  *x509.CertPool
+
+	restartMu sync.Mutex
+	serving   []listener
+	child     *os.Process
 }
 
 func (s *Server) Use() string {
@@ -66,46 +113,95 @@ func (s *Server) Init() {
 func (s *Server) init() {
 	s.start = time.Now().Truncate(time.Second)
 	s.engine = gin.New()
+	// see clientIP
+	s.engine.ForwardedByClientIP = false
+	s.metrics = s.newMetrics()
 
 	var err error
 
-	s.db, err = s.getDB()
+	s.tracer, err = s.getTracer()
+	if err != nil {
+		logrus.WithError(err).Panic("unable to get tracer")
+	}
+
+	s.connections, err = s.getConnections()
 	if err != nil {
-		logrus.WithError(err).Panic("unable to get database connection")
+		logrus.WithError(err).Panic("unable to get relationship connections")
 	}
 
-	s.accessor = sql.NewAccessor(s.db)
-	s.signer, err = s.getSigner()
+	// the database is opened in the background by loadSessionStore; the
+	// accessor fails until then
+	s.accessor = sql.NewAccessor(nil)
+	s.connections.OnOpen("database", s.setDB)
+
+	if err := s.loadPKI(); err != nil {
+		logrus.WithError(err).Panic("unable to load PKI material")
+	}
+
+	s.proxies, err = parseNetworks(s.TrustedProxies)
 	if err != nil {
-		logrus.WithError(err).Panic("unable to get certificate signer")
+		logrus.WithError(err).Panic("unable to parse trusted proxies")
 	}
-	s.signer.SetDBAccessor(s.accessor)
 
-	s.ocspSigner, err = s.getOCSPSigner()
+	s.rateLimits, err = parseRateLimits(s.RateLimits)
 	if err != nil {
-		logrus.WithError(err).Panic("unable to get OCSP signer")
+		logrus.WithError(err).Panic("unable to parse rate limits")
+	}
+	s.limiter = s.getRateLimitStore()
+
+	s.sessionStore = newReloadableStore(s.GetSessionStore)
+	go s.loadSessionStore()
+	s.Subscribe(s.Prefix()+"PROJECT_ENTROPY", s.reloadSessionStore)
+	go s.purgeSessions(time.Hour)
+	if s.WatchInterval > 0 {
+		go s.Watch(s, s.WatchInterval)
+		go s.watchKeyRing(s.WatchInterval)
 	}
 
 	s.register(s.engine)
+	s.engine.NoRoute(s.notFound)
+	s.indexRoutes()
 }
 
-func (s *Server) getDB() (*sqlx.DB, error) {
+func (s *Server) getConnections() (*platformsh.Connections, error) {
 	rels, err := s.Relationships()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to locate relationships")
 	}
 
-	dbOpen, err := rels.Postgresql("database")
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to get database connection string")
+	conns := platformsh.NewConnections(rels)
+	driverName := "postgres"
+	if s.tracer != nil {
+		driverName = tracedPostgresDriver
 	}
+	s.pemFiles = platformsh.NewPEMFiles(s.FileSystem(), s.TempDir)
+	conns.Register("database", platformsh.PostgresqlDriverDialer(driverName, s.pemFiles))
+	// only the stores in use need the sessions relationship, and /health
+	// reports every registered relationship
+	if s.SessionStore == "mongo" || s.RateLimitStore == "mongo" {
+		conns.Register("sessions", platformsh.MongoDBDialer)
+	}
+	conns.Publish("connections")
 
-	db, err := sqlx.Open("postgres", dbOpen)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to connect to postgres")
+	if s.HealthInterval > 0 {
+		go conns.HealthCheck(s.HealthInterval)
 	}
 
-	return db, nil
+	return conns, nil
+}
+
+func (s *Server) setDB(client platformsh.Client) {
+	c, ok := client.(*platformsh.SQLClient)
+	if !ok {
+		logrus.WithField("client", client).Error("unexpected database client")
+		return
+	}
+
+	db := sqlx.NewDb(c.DB, "postgres")
+	s.dbMu.Lock()
+	s.db = db
+	s.dbMu.Unlock()
+	s.accessor.SetDB(db)
 }
 
 func (s *Server) getSigner() (signer.Signer, error) {
@@ -185,81 +281,226 @@ func (s *Server) getOCSPSigner() (ocsp.Signer, error) {
 func (s *Server) Serve() error {
 	s.Init()
 
-	l, err := s.Listener()
+	listeners, err := s.listeners()
 	if err != nil {
 		return errors.Wrap(err, "unable to open listener")
 	}
-	defer l.Close()
 
-	done := make(chan error)
-	defer close(done)
+	s.restartMu.Lock()
+	s.serving = listeners
+	s.restartMu.Unlock()
 
-	go func() {
-		srv := http.Server{Handler: s.engine}
-		go func() {
+	// requests remember which listener accepted them, see fromTrustedProxy
+	serving := make(map[net.Listener]listener, len(listeners))
+	for _, l := range listeners {
+		var nl net.Listener = l
+		if l.TLS {
+			nl = tls.NewListener(l, s.serverTLSConfig())
+		}
+		serving[nl] = l
+	}
+
+	srv := http.Server{
+		Handler: s.engine,
+		BaseContext: func(nl net.Listener) context.Context {
+			return context.WithValue(context.Background(), listenerContextKey, serving[nl])
+		},
+	}
+	done := make(chan error, len(listeners))
+	for nl := range serving {
+		go func(l net.Listener) {
 			done <- srv.Serve(l)
-		}()
+		}(nl)
+	}
+
+	app.OnSignal(s, s.handleSignal, syscall.SIGHUP, syscall.SIGUSR2)
+	s.setReady(true)
+	s.notifyParent()
 
-		<-s.Done()
-		logrus.WithError(s.Err()).Debug("context done")
+	// stopped by a signal, or when the listeners stop on their own
+	quit, stop := context.WithCancel(s)
+	defer stop()
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+
+		<-quit.Done()
+		s.setReady(false)
+		// a failed listener has already closed the rest
+		if s.ShutdownDelay > 0 && s.Err() != nil {
+			logrus.WithField("delay", s.ShutdownDelay).Info("waiting for traffic to stop")
+			time.Sleep(s.ShutdownDelay)
+		}
+
+		logrus.WithError(s.Err()).WithField("timeout", s.DrainTimeout).Info("draining connections")
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.DrainTimeout)
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
-			logrus.WithError(err).Warn("error shutting down server")
+			logrus.WithError(err).Warn("error draining connections; closing them")
+			_ = srv.Close()
+		}
+
+		// only now that no request is left
+		s.connections.Close()
+		if err := s.pemFiles.Close(); err != nil {
+			logrus.WithError(err).Warn("unable to remove inline certificates")
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.tracer.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Warn("unable to export remaining spans")
 		}
 	}()
 
-	err = <-done
+	// the first listener to fail stops the rest
+	var rv error
+	for range listeners {
+		err := <-done
+		if err != nil {
+			logrus.WithError(err).Warning("server shutdown")
+		}
+		if err != http.ErrServerClosed && rv == nil {
+			rv = err
+			_ = srv.Close()
+		}
+	}
+
+	// Serve returns as soon as draining starts or a listener fails; either
+	// way the connections are closed and the spans exported first
+	stop()
+	<-shutdown
+	return rv
+}
+
+// masterSecret is the --session-secret or the project entropy. There is no
+// fallback: keys derived from anything else would either be guessable or not
+// survive a restart.
+func (s *Server) masterSecret() ([]byte, error) {
+	if s.SessionSecret != "" {
+		if len(s.SessionSecret) < minSessionSecret {
+			return nil, errors.Errorf("the session secret must be at least %d bytes", minSessionSecret)
+		}
+		return []byte(s.SessionSecret), nil
+	}
+
+	entropy, err := s.ProjectEntropy()
 	if err != nil {
-		logrus.WithError(err).Warning("server shutdown")
+		return nil, errors.Wrap(err, "project entropy not found and no session secret given")
 	}
-	if err == http.ErrServerClosed {
-		return nil
+	logrus.WithField("entropy", platformsh.Redact(entropy)).Debug("found project entropy")
+
+	rv, err := base32.StdEncoding.DecodeString(entropy)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode project entropy")
 	}
-	return err
+	return rv, nil
 }
 
-func (s *Server) GetSecret() []byte {
-	entropy, err := s.ProjectEntropy()
-	if err == nil {
-		logrus.WithField("entropy", entropy).Debug("found project entropy")
-		if rv, err := base32.StdEncoding.DecodeString(entropy); err == nil {
-			return rv
-		} else {
-			logrus.WithField("err", err).WithField("entropy", entropy).Warn("error decoding project entropy")
-		}
-	} else {
-		logrus.WithField("err", err).Warn("project entropy not found")
+// GetKeyRing derives the session keys of the newest key generations, see
+// the rotate command. It fails rather than guessing the generations, which
+// would invalidate sessions signed by the others.
+func (s *Server) GetKeyRing() (keyring.Ring, error) {
+	master, err := s.masterSecret()
+	if err != nil {
+		return nil, err
 	}
 
-	secret := make([]byte, 40)
-	_, _ = rand.Read(secret)
-	logrus.WithField("secret", base32.StdEncoding.EncodeToString(secret)).Warn("using random secret")
-	return secret
+	gens, err := s.keyGenerations(s.SessionKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load key generations")
+	}
+
+	ring := keyring.Derive(master, gens...)
+	atomic.StoreInt64(&s.keyGen, int64(ring.Current()))
+	logrus.WithField("generation", ring.Current()).Info("derived session keys")
+	return ring, nil
 }
 
-func (s *Server) GetSessionStore() sessions.Store {
-	secret := s.GetSecret() // TODO: rotate secret?
-	var store sessions.Store
-	if rels, err := s.Relationships(); err == nil {
-		db, err := rels.MongoDB("sessions")
-		if err == nil {
-			col := db.C("sessions")
-			store = mongo.NewStore(col, OneYear, true, secret)
-		} else {
-			logrus.WithError(err).Warn("unable to connect to mongo server")
+func (s *Server) keyGenerations(limit int) ([]int, error) {
+	db, err := s.connections.SQL("database")
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.EnsureSchema(s, db); err != nil {
+		return nil, err
+	}
+	return keyring.Generations(s, db, limit)
+}
+
+// watchKeyRing reloads the session store after a rotation.
+func (s *Server) watchKeyRing(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Done():
+			return
+		case <-ticker.C:
 		}
-	} else {
-		logrus.WithField("err", err).Warn("unable to determine relationships")
+
+		gens, err := s.keyGenerations(1)
+		if err != nil {
+			logrus.WithError(err).Debug("unable to check key generations")
+			continue
+		}
+		if int64(gens[0]) != atomic.LoadInt64(&s.keyGen) {
+			logrus.WithField("generation", gens[0]).Info("session keys rotated")
+			s.reloadSessionStore("session_keys", "", true)
+		}
+	}
+}
+
+// GetSessionStore falls back to the cookie store when the configured store
+// is unavailable; checkSessions reports the fallback.
+func (s *Server) GetSessionStore() (sessions.Store, error) {
+	ring, err := s.GetKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := ring.Pairs()
+	var store sessions.Store
+	if backend, err := s.getSessionBackend(); err != nil {
+		logrus.WithError(err).WithField("store", s.SessionStore).Error("unable to use the session store; falling back to cookies")
+	} else if backend != nil {
+		store = sessionstore.NewStore(backend, keys...)
 	}
 	if store == nil {
 		logrus.Warn("using cookie session store")
-		store = cookie.NewStore(secret)
+		store = cookie.NewStore(keys...)
 	}
 	store.Options(sessions.Options{
-		MaxAge: OneMonth,
-		Secure: true,
+		MaxAge:   int(s.SessionTTL / time.Second),
+		Secure:   true,
+		HttpOnly: true,
 	})
-	return store
+	return store, nil
+}
+
+// getSessionBackend returns nil for the cookie store.
+func (s *Server) getSessionBackend() (sessionstore.Backend, error) {
+	switch s.SessionStore {
+	case "mongo":
+		return sessionstore.NewMongoBackend(func() (*mgo.Collection, error) {
+			db, err := s.connections.MongoDB("sessions")
+			if err != nil {
+				return nil, err
+			}
+			return db.C("sessions"), nil
+		})
+	case "postgres":
+		return sessionstore.NewPostgresBackend(func() (*stdsql.DB, error) {
+			return s.connections.SQL("database")
+		})
+	case "memory":
+		return sessionstore.NewMemoryBackend(), nil
+	case "cookie", "":
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unknown session store %q", s.SessionStore)
+	}
 }
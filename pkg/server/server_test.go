@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+
+	"github.com/demosdemon/super-potato/pkg/app"
+	"github.com/demosdemon/super-potato/pkg/keyring"
+	"github.com/demosdemon/super-potato/pkg/platformsh"
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
+)
+
+// httptest requests come from this address, which the test server trusts as
+// a proxy.
+const testProxy = "192.0.2.1"
+
+type testServer struct {
+	*Server
+	engine  *gin.Engine
+	backend *sessionstore.MemoryBackend
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestServer registers the routes of the server with an empty
+// environment, sessions in memory and a client CA of its own.
+func newTestServer(t *testing.T) *testServer {
+	env := platformsh.NewEnvironment("PLATFORM_")
+	env.SetFileSystem(afero.NewMemMapFs())
+	env.SetSources(platformsh.MapSource{})
+
+	s := &Server{
+		App: &app.App{
+			Context:     context.Background(),
+			Fs:          afero.NewMemMapFs(),
+			Environment: env,
+		},
+		SessionCookie:   "test",
+		SessionTTL:      time.Hour,
+		AccessLogSample: 1,
+	}
+	s.start = time.Now()
+	s.metrics = s.newMetrics()
+
+	var err error
+	s.proxies, err = parseNetworks([]string{testProxy})
+	require.NoError(t, err)
+
+	ts := &testServer{Server: s, backend: sessionstore.NewMemoryBackend()}
+	ts.ca, ts.caKey = newTestCertificate(t, "Test CA", nil, nil)
+	s.clientCAs = x509.NewCertPool()
+	s.clientCAs.AddCert(ts.ca)
+
+	keys := keyring.Derive([]byte("test secret"), 0).Pairs()
+	s.sessionStore = newReloadableStore(func() (sessions.Store, error) {
+		return sessionstore.NewStore(ts.backend, keys...), nil
+	})
+	require.NoError(t, s.sessionStore.Reload())
+
+	ts.engine = gin.New()
+	s.register(ts.engine)
+	return ts
+}
+
+// clientCert returns a client certificate for cn in the form of the
+// X-Client-Cert header, signed by the CA of the server unless untrusted.
+func (ts *testServer) clientCert(t *testing.T, cn string, untrusted bool) string {
+	parent, parentKey := ts.ca, ts.caKey
+	if untrusted {
+		parent, parentKey = nil, nil
+	}
+	cert, _ := newTestCertificate(t, cn, parent, parentKey)
+	return url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+}
+
+func (ts *testServer) do(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.engine.ServeHTTP(w, req)
+	return w
+}
+
+// testDN is the distinguished name of the certificates of cn.
+func testDN(cn string) string {
+	return testSubject(cn).String()
+}
+
+func testSubject(cn string) pkix.Name {
+	return pkix.Name{CommonName: cn, Organization: []string{"super-potato"}}
+}
+
+// newTestCertificate signs a CA certificate when parent is nil, and a client
+// certificate otherwise.
+func newTestCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      testSubject(cn),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		parent, parentKey = tmpl, key
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
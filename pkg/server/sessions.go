@@ -0,0 +1,265 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/demosdemon/super-potato/pkg/sessionstore"
+	"github.com/demosdemon/super-potato/pkg/tracing"
+)
+
+// reloadableStore delegates to a session store that can be swapped out
+// while the server is running, e.g. when the project entropy changes. Until
+// the first store is built, sessions can't be loaded or saved.
+type reloadableStore struct {
+	mu      sync.RWMutex
+	store   sessions.Store
+	options *sessions.Options
+	build   func() (sessions.Store, error)
+}
+
+var errNoSessionStore = errors.New("the session store isn't loaded yet")
+
+func newReloadableStore(build func() (sessions.Store, error)) *reloadableStore {
+	return &reloadableStore{build: build}
+}
+
+// current is nil until the first store is built.
+func (r *reloadableStore) current() sessions.Store {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.store
+}
+
+// Reload replaces the store; the previous one is kept when building fails.
+func (r *reloadableStore) Reload() error {
+	store, err := r.build()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.options != nil {
+		store.Options(*r.options)
+	}
+	r.store = store
+	return nil
+}
+
+func (r *reloadableStore) Get(req *http.Request, name string) (*gorilla.Session, error) {
+	_, span := tracing.Start(req.Context(), "session.get", tracing.KindInternal)
+	defer span.End()
+
+	store := r.current()
+	if store == nil {
+		span.SetError(errNoSessionStore)
+		return gorilla.NewSession(r, name), errNoSessionStore
+	}
+
+	rv, err := store.Get(req, name)
+	span.SetError(err)
+	return rv, err
+}
+
+func (r *reloadableStore) New(req *http.Request, name string) (*gorilla.Session, error) {
+	_, span := tracing.Start(req.Context(), "session.new", tracing.KindInternal)
+	defer span.End()
+
+	store := r.current()
+	if store == nil {
+		span.SetError(errNoSessionStore)
+		return gorilla.NewSession(r, name), errNoSessionStore
+	}
+
+	rv, err := store.New(req, name)
+	span.SetError(err)
+	return rv, err
+}
+
+func (r *reloadableStore) Save(req *http.Request, w http.ResponseWriter, s *gorilla.Session) error {
+	_, span := tracing.Start(req.Context(), "session.save", tracing.KindInternal)
+	defer span.End()
+
+	store := r.current()
+	if store == nil {
+		span.SetError(errNoSessionStore)
+		return errNoSessionStore
+	}
+
+	// gin's options can't express SameSite; Lax keeps the cookie off
+	// cross-site subrequests and form posts
+	if s.Options != nil {
+		opts := *s.Options
+		opts.SameSite = http.SameSiteLaxMode
+		s.Options = &opts
+	}
+
+	err := store.Save(req, w, s)
+	span.SetError(err)
+	return err
+}
+
+func (r *reloadableStore) Options(options sessions.Options) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.options = &options
+	if r.store != nil {
+		r.store.Options(options)
+	}
+}
+
+func (s *Server) reloadSessionStore(name, _ string, _ bool) {
+	logrus.WithField("name", name).Info("reloading session store")
+	if err := s.sessionStore.Reload(); err != nil {
+		logrus.WithError(err).Error("unable to reload the session store; keeping the previous keys")
+	}
+}
+
+// loadSessionStore builds the first session store, retrying until the
+// database is reachable; /readyz fails until then.
+func (s *Server) loadSessionStore() {
+	delay := time.Second
+	for {
+		err := s.sessionStore.Reload()
+		if err == nil {
+			return
+		}
+		logrus.WithError(err).WithField("retry", delay).Warn("unable to load the session store")
+
+		select {
+		case <-s.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// sessionBackend returns nil when sessions are kept in cookies.
+func (s *Server) sessionBackend() sessionstore.Backend {
+	if store, ok := s.sessionStore.current().(*sessionstore.Store); ok {
+		return store.Backend
+	}
+	return nil
+}
+
+func (s *Server) purgeSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backend := s.sessionBackend()
+		if backend == nil {
+			continue
+		}
+		n, err := backend.Purge(s)
+		if err != nil {
+			logrus.WithError(err).Warn("unable to purge expired sessions")
+			continue
+		}
+		logrus.WithField("purged", n).Debug("purged expired sessions")
+	}
+}
+
+type sessionView struct {
+	sessionstore.Record `yaml:",inline"`
+	Current             bool `json:"current" yaml:"current"`
+}
+
+// sessionBackendOrProblem renders a problem when sessions can't be managed.
+func (s *Server) sessionBackendOrProblem(c *gin.Context) sessionstore.Backend {
+	backend := s.sessionBackend()
+	if backend == nil {
+		s.problem(c, NewProblem(http.StatusNotImplemented, "sessions kept in cookies can't be listed or revoked"))
+	}
+	return backend
+}
+
+func (s *Server) getSessions(c *gin.Context) {
+	backend := s.sessionBackendOrProblem(c)
+	if backend == nil {
+		return
+	}
+
+	records, err := backend.List(c.Request.Context(), getUser(c).UserName())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	current, _ := sessions.Default(c).Get(sessionstore.IDKey).(string)
+	rv := make([]sessionView, len(records))
+	for idx, rec := range records {
+		rv[idx] = sessionView{rec, rec.ID == current}
+	}
+	s.negotiate(c, http.StatusOK, gin.H{"sessions": rv})
+}
+
+// deleteSession revokes one of the user's sessions, possibly the current one.
+func (s *Server) deleteSession(c *gin.Context) {
+	backend := s.sessionBackendOrProblem(c)
+	if backend == nil {
+		return
+	}
+
+	id := c.Param("id")
+	rec, err := backend.Load(c.Request.Context(), id)
+	if err == sessionstore.ErrNotFound || (err == nil && rec.Owner != getUser(c).UserName()) {
+		s.problem(c, NewProblem(http.StatusNotFound, "no session "+id))
+		return
+	} else if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if err := backend.Delete(c.Request.Context(), id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	getLogger(c).WithField("session", id).Info("session revoked")
+	c.Status(http.StatusNoContent)
+}
+
+// deleteOwnerSessions revokes every session of the DN in the dn query
+// parameter.
+func (s *Server) deleteOwnerSessions(c *gin.Context) {
+	backend := s.sessionBackendOrProblem(c)
+	if backend == nil {
+		return
+	}
+
+	dn := c.Query("dn")
+	if dn == "" {
+		s.problem(c, NewProblem(http.StatusBadRequest, "the dn query parameter is required"))
+		return
+	}
+
+	n, err := backend.DeleteOwner(c.Request.Context(), dn)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	getLogger(c).WithFields(logrus.Fields{
+		"admin":   getUser(c).UserName(),
+		"dn":      dn,
+		"revoked": n,
+	}).Info("sessions revoked")
+	s.negotiate(c, http.StatusOK, gin.H{"dn": dn, "revoked": n})
+}
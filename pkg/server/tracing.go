@@ -0,0 +1,94 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"github.com/demosdemon/super-potato/pkg/tracing"
+)
+
+const (
+	traceService         = "super-potato"
+	tracedPostgresDriver = "postgres+tracing"
+)
+
+var registerTracedDriver sync.Once
+
+// getTracer returns nil when tracing is disabled. Spans are posted to an
+// OTLP/HTTP endpoint, or else appended to a file (- is stdout).
+func (s *Server) getTracer() (*tracing.Tracer, error) {
+	endpoint := s.TraceEndpoint
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	var exporter tracing.Exporter
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		exporter = tracing.NewOTLPExporter(endpoint, traceService)
+	} else {
+		fp, err := s.Append(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporter = tracing.NewWriterExporter(fp)
+	}
+
+	tracer := tracing.NewTracer(traceService, exporter)
+	registerTracedDriver.Do(func() {
+		sql.Register(tracedPostgresDriver, tracing.WrapDriver(&pq.Driver{}, tracer, "postgresql"))
+	})
+	return tracer, nil
+}
+
+func (s *Server) tracingMiddleware(c *gin.Context) {
+	ctx := c.Request.Context()
+	if sc, err := tracing.ParseTraceparent(c.GetHeader(tracing.TraceparentHeader)); err == nil {
+		ctx = tracing.ContextWithRemote(ctx, sc)
+	}
+
+	route := s.routeLabel(c)
+	ctx, span := s.tracer.Start(ctx, c.Request.Method+" "+route, tracing.KindServer)
+	defer span.End()
+
+	span.SetAttribute("http.method", c.Request.Method)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("http.target", c.Request.URL.RequestURI())
+	span.SetAttribute("http.user_agent", c.Request.UserAgent())
+	span.SetAttribute("net.peer.ip", s.clientIP(c))
+	span.SetAttribute("http.request_id", getRequestID(c))
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	code := c.Writer.Status()
+	span.SetAttribute("http.status_code", code)
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(tracing.StatusError, http.StatusText(code))
+	}
+	if len(c.Errors) > 0 {
+		span.SetAttribute("error.message", c.Errors.String())
+	}
+}
+
+// handlerSpanMiddleware must be the last middleware so that its span covers
+// the handlers of the matched route.
+func (s *Server) handlerSpanMiddleware(c *gin.Context) {
+	ctx, span := tracing.Start(c.Request.Context(), "handler "+shortHandlerName(c.HandlerName()), tracing.KindInternal)
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// shortHandlerName turns pkg/server.(*Server).getPing-fm into getPing.
+func shortHandlerName(name string) string {
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
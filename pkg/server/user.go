@@ -1,6 +1,8 @@
 package server
 
 import (
+	"strings"
+
 	"github.com/demosdemon/super-potato/pkg/pki"
 )
 
@@ -26,9 +28,13 @@ func (AnonymousUser) Authenticated() bool {
 
 var TheAnonymousUser = AnonymousUser{}
 
+// CertifiedUser is identified by a client certificate. DistinguishedName is
+// the Subject of the certificate, and Verified is only set once its chain was
+// verified against the client CAs.
 type CertifiedUser struct {
 	ClientCertificate pki.Certificate
 	DistinguishedName string
+	Verified          bool
 }
 
 func (u *CertifiedUser) UserName() string {
@@ -40,6 +46,31 @@ func (u *CertifiedUser) EmailAddress() string {
 }
 
 func (u *CertifiedUser) Authenticated() bool {
-	// TODO: validate ClientCertificate is signed by an approved issuer
-	return true
+	return u.Verified
+}
+
+// DNList is a repeatable flag; unlike []string flags, values aren't split on
+// commas, which distinguished names are full of.
+type DNList []string
+
+func (l *DNList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *DNList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func (l *DNList) Type() string {
+	return "dn"
+}
+
+func (l DNList) Contains(dn string) bool {
+	for _, v := range l {
+		if v == dn {
+			return true
+		}
+	}
+	return false
 }
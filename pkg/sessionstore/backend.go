@@ -0,0 +1,130 @@
+package sessionstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Record is a session as it is kept by a Backend. Data holds the encoded
+// session values; the other fields are copied out of them so that sessions
+// can be listed without the key.
+type Record struct {
+	ID        string    `json:"id" yaml:"id"`
+	Owner     string    `json:"owner,omitempty" yaml:"owner,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty" yaml:"client_ip,omitempty"`
+	Data      string    `json:"-" yaml:"-"`
+	Created   time.Time `json:"created" yaml:"created"`
+	Modified  time.Time `json:"modified" yaml:"modified"`
+	Expires   time.Time `json:"expires" yaml:"expires"`
+}
+
+// Backend persists records. Expired records are never returned.
+type Backend interface {
+	// Load returns ErrNotFound for a missing or expired session.
+	Load(ctx context.Context, id string) (*Record, error)
+	// Save inserts or updates a record; Created is kept from the first save.
+	Save(ctx context.Context, r *Record) error
+	Delete(ctx context.Context, id string) error
+	// List returns the sessions of owner, most recently used first.
+	List(ctx context.Context, owner string) ([]Record, error)
+	DeleteOwner(ctx context.Context, owner string) (int64, error)
+	// Purge removes expired records.
+	Purge(ctx context.Context) (int64, error)
+	Ping(ctx context.Context) error
+}
+
+// MemoryBackend keeps the sessions of a single instance; they are lost on
+// restart.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{records: make(map[string]Record)}
+}
+
+func (m *MemoryBackend) Load(_ context.Context, id string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.records[id]
+	if !ok || !r.Expires.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &r, nil
+}
+
+func (m *MemoryBackend) Save(_ context.Context, r *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec := *r
+	if prev, ok := m.records[r.ID]; ok {
+		rec.Created = prev.Created
+	}
+	m.records[r.ID] = rec
+	return nil
+}
+
+func (m *MemoryBackend) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, id)
+	return nil
+}
+
+func (m *MemoryBackend) List(_ context.Context, owner string) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var rv []Record
+	for _, r := range m.records {
+		if r.Owner == owner && r.Expires.After(now) {
+			rv = append(rv, r)
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Modified.After(rv[j].Modified) })
+	return rv, nil
+}
+
+func (m *MemoryBackend) DeleteOwner(_ context.Context, owner string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rv int64
+	for id, r := range m.records {
+		if r.Owner == owner {
+			delete(m.records, id)
+			rv++
+		}
+	}
+	return rv, nil
+}
+
+func (m *MemoryBackend) Purge(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var rv int64
+	for id, r := range m.records {
+		if !r.Expires.After(now) {
+			delete(m.records, id)
+			rv++
+		}
+	}
+	return rv, nil
+}
+
+func (m *MemoryBackend) Ping(context.Context) error {
+	return nil
+}
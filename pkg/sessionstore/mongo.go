@@ -0,0 +1,147 @@
+package sessionstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+)
+
+// MongoBackend keeps sessions in a collection; MongoDB removes expired
+// sessions with a TTL index.
+type MongoBackend struct {
+	collection func() (*mgo.Collection, error)
+}
+
+type mongoRecord struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	UserAgent string    `bson:"user_agent"`
+	ClientIP  string    `bson:"client_ip"`
+	Data      string    `bson:"data"`
+	Created   time.Time `bson:"created"`
+	Modified  time.Time `bson:"modified"`
+	Expires   time.Time `bson:"expires"`
+}
+
+// NewMongoBackend creates the owner and expiry indexes. The collection is
+// not kept; fn is asked for it again on every call.
+func NewMongoBackend(fn func() (*mgo.Collection, error)) (*MongoBackend, error) {
+	col, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := []mgo.Index{
+		{Key: []string{"owner"}, Background: true},
+		{Key: []string{"expires"}, ExpireAfter: time.Second, Background: true},
+	}
+	for _, idx := range indexes {
+		if err := col.EnsureIndex(idx); err != nil {
+			return nil, errors.Wrapf(err, "unable to create the %v index", idx.Key)
+		}
+	}
+
+	return &MongoBackend{collection: fn}, nil
+}
+
+func (m *MongoBackend) Load(_ context.Context, id string) (*Record, error) {
+	col, err := m.collection()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc mongoRecord
+	err = col.Find(bson.M{"_id": id, "expires": bson.M{"$gt": time.Now()}}).One(&doc)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rv := Record(doc)
+	return &rv, nil
+}
+
+func (m *MongoBackend) Save(_ context.Context, r *Record) error {
+	col, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	_, err = col.UpsertId(r.ID, bson.M{
+		"$set": bson.M{
+			"owner":      r.Owner,
+			"user_agent": r.UserAgent,
+			"client_ip":  r.ClientIP,
+			"data":       r.Data,
+			"modified":   r.Modified,
+			"expires":    r.Expires,
+		},
+		"$setOnInsert": bson.M{"created": r.Created},
+	})
+	return err
+}
+
+func (m *MongoBackend) Delete(_ context.Context, id string) error {
+	col, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	err = col.RemoveId(id)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (m *MongoBackend) List(_ context.Context, owner string) ([]Record, error) {
+	col, err := m.collection()
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []mongoRecord
+	err = col.Find(bson.M{"owner": owner, "expires": bson.M{"$gt": time.Now()}}).Sort("-modified").All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]Record, len(docs))
+	for idx, doc := range docs {
+		rv[idx] = Record(doc)
+	}
+	return rv, nil
+}
+
+func (m *MongoBackend) DeleteOwner(_ context.Context, owner string) (int64, error) {
+	return m.removeAll(bson.M{"owner": owner})
+}
+
+func (m *MongoBackend) Purge(context.Context) (int64, error) {
+	return m.removeAll(bson.M{"expires": bson.M{"$lte": time.Now()}})
+}
+
+func (m *MongoBackend) removeAll(selector bson.M) (int64, error) {
+	col, err := m.collection()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := col.RemoveAll(selector)
+	if err != nil {
+		return 0, err
+	}
+	return int64(info.Removed), nil
+}
+
+func (m *MongoBackend) Ping(context.Context) error {
+	col, err := m.collection()
+	if err != nil {
+		return err
+	}
+	return col.Database.Session.Ping()
+}
@@ -0,0 +1,141 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         text PRIMARY KEY,
+	owner      text NOT NULL DEFAULT '',
+	user_agent text NOT NULL DEFAULT '',
+	client_ip  text NOT NULL DEFAULT '',
+	data       text NOT NULL,
+	created    timestamptz NOT NULL,
+	modified   timestamptz NOT NULL,
+	expires    timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_owner_idx ON sessions (owner);
+CREATE INDEX IF NOT EXISTS sessions_expires_idx ON sessions (expires);
+`
+
+const postgresColumns = `id, owner, user_agent, client_ip, data, created, modified, expires`
+
+// PostgresBackend keeps sessions in the sessions table, which it creates if
+// needed. Expired sessions are removed by Purge.
+type PostgresBackend struct {
+	db func() (*sql.DB, error)
+}
+
+// NewPostgresBackend creates the sessions table in the database returned by
+// fn, which then serves every query.
+func NewPostgresBackend(fn func() (*sql.DB, error)) (*PostgresBackend, error) {
+	db, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		return nil, errors.Wrap(err, "unable to create the sessions table")
+	}
+	return &PostgresBackend{db: fn}, nil
+}
+
+func (p *PostgresBackend) Load(ctx context.Context, id string) (*Record, error) {
+	db, err := p.db()
+	if err != nil {
+		return nil, err
+	}
+
+	row := db.QueryRowContext(ctx, `SELECT `+postgresColumns+` FROM sessions WHERE id = $1 AND expires > now()`, id)
+	var r Record
+	err = row.Scan(&r.ID, &r.Owner, &r.UserAgent, &r.ClientIP, &r.Data, &r.Created, &r.Modified, &r.Expires)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *PostgresBackend) Save(ctx context.Context, r *Record) error {
+	db, err := p.db()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO sessions (`+postgresColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			user_agent = EXCLUDED.user_agent,
+			client_ip = EXCLUDED.client_ip,
+			data = EXCLUDED.data,
+			modified = EXCLUDED.modified,
+			expires = EXCLUDED.expires`,
+		r.ID, r.Owner, r.UserAgent, r.ClientIP, r.Data, r.Created, r.Modified, r.Expires,
+	)
+	return err
+}
+
+func (p *PostgresBackend) Delete(ctx context.Context, id string) error {
+	_, err := p.exec(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+func (p *PostgresBackend) List(ctx context.Context, owner string) ([]Record, error) {
+	db, err := p.db()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+postgresColumns+` FROM sessions
+		WHERE owner = $1 AND expires > now()
+		ORDER BY modified DESC`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rv []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.ID, &r.Owner, &r.UserAgent, &r.ClientIP, &r.Data, &r.Created, &r.Modified, &r.Expires); err != nil {
+			return nil, err
+		}
+		rv = append(rv, r)
+	}
+	return rv, rows.Err()
+}
+
+func (p *PostgresBackend) DeleteOwner(ctx context.Context, owner string) (int64, error) {
+	return p.exec(ctx, `DELETE FROM sessions WHERE owner = $1`, owner)
+}
+
+func (p *PostgresBackend) Purge(ctx context.Context) (int64, error) {
+	return p.exec(ctx, `DELETE FROM sessions WHERE expires <= now()`)
+}
+
+func (p *PostgresBackend) Ping(ctx context.Context) error {
+	db, err := p.db()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
+func (p *PostgresBackend) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	db, err := p.db()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,156 @@
+// Package sessionstore implements a server-side session store whose sessions
+// can be listed and revoked by owner.
+package sessionstore
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	ginsessions "github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// The session values copied into a Record. IDKey is set by the store.
+const (
+	IDKey        = "id"
+	OwnerKey     = "owner"
+	UserAgentKey = "user_agent"
+	ClientIPKey  = "client_ip"
+)
+
+// Store keeps session values in a Backend; the cookie only holds the signed
+// session ID.
+type Store struct {
+	Backend Backend
+	Codecs  []securecookie.Codec
+	options *sessions.Options
+}
+
+var _ ginsessions.Store = (*Store)(nil)
+
+func NewStore(backend Backend, keyPairs ...[]byte) *Store {
+	s := &Store{
+		Backend: backend,
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		options: &sessions.Options{Path: "/"},
+	}
+	return s
+}
+
+func (s *Store) Options(options ginsessions.Options) {
+	s.options = &sessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+
+	// the encoded values must not expire before the session does
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(options.MaxAge)
+		}
+	}
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a new session when the cookie is missing, invalid or refers to
+// a session that was revoked or has expired.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.Codecs...); err != nil {
+		return session, nil
+	}
+
+	rec, err := s.Backend.Load(r.Context(), id)
+	if err == ErrNotFound {
+		return session, nil
+	} else if err != nil {
+		return session, err
+	}
+
+	if err := securecookie.DecodeMulti(name, rec.Data, &session.Values, s.Codecs...); err != nil {
+		return session, nil
+	}
+
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+// Save deletes the session when its MaxAge is negative.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.Backend.Delete(r.Context(), session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if id, _ := session.Values[IDKey].(string); id != "" {
+		session.ID = id
+	} else if session.ID == "" {
+		session.ID = NewID()
+	}
+	session.Values[IDKey] = session.ID
+
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rec := &Record{
+		ID:       session.ID,
+		Data:     data,
+		Created:  now,
+		Modified: now,
+		Expires:  now.Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	rec.Owner, _ = session.Values[OwnerKey].(string)
+	rec.UserAgent, _ = session.Values[UserAgentKey].(string)
+	rec.ClientIP, _ = session.Values[ClientIPKey].(string)
+	if session.Options.MaxAge == 0 {
+		// a browser session; keep it for a day at most
+		rec.Expires = now.Add(24 * time.Hour)
+	}
+
+	if err := s.Backend.Save(r.Context(), rec); err != nil {
+		return err
+	}
+
+	cookie, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), cookie, session.Options))
+	return nil
+}
+
+// NewID returns a random session ID.
+func NewID() string {
+	var buf [32]byte
+	_, _ = rand.Read(buf[:])
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(buf[:]), "=")
+}
@@ -0,0 +1,135 @@
+package sessionstore_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ginsessions "github.com/gin-contrib/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/sessionstore"
+)
+
+const cookieName = "session"
+
+func newStore(backend Backend) *Store {
+	s := NewStore(backend, []byte("0123456789abcdef0123456789abcdef"))
+	s.Options(ginsessions.Options{Path: "/", MaxAge: 3600, HttpOnly: true})
+	return s
+}
+
+func request(cookies ...*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+// save stores values in a new session and returns its cookie.
+func save(t *testing.T, s *Store, values map[interface{}]interface{}) *http.Cookie {
+	r := request()
+	session, err := s.New(r, cookieName)
+	require.NoError(t, err)
+	assert.True(t, session.IsNew)
+	for k, v := range values {
+		session.Values[k] = v
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, s.Save(r, w, session))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func TestStore(t *testing.T) {
+	backend := NewMemoryBackend()
+	s := newStore(backend)
+
+	cookie := save(t, s, map[interface{}]interface{}{
+		"count":      3,
+		OwnerKey:     "CN=alice",
+		UserAgentKey: "curl/7.64.0",
+	})
+	assert.Equal(t, 3600, cookie.MaxAge)
+
+	session, err := s.New(request(cookie), cookieName)
+	require.NoError(t, err)
+	assert.False(t, session.IsNew)
+	assert.Equal(t, 3, session.Values["count"])
+	assert.Equal(t, session.ID, session.Values[IDKey])
+
+	list, err := backend.List(context.Background(), "CN=alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, session.ID, list[0].ID)
+	assert.Equal(t, "curl/7.64.0", list[0].UserAgent)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), list[0].Expires, time.Minute)
+
+	// a revoked session is replaced by a new one
+	n, err := backend.DeleteOwner(context.Background(), "CN=alice")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	session, err = s.New(request(cookie), cookieName)
+	require.NoError(t, err)
+	assert.True(t, session.IsNew)
+	assert.Empty(t, session.Values)
+}
+
+func TestStore_InvalidCookie(t *testing.T) {
+	s := newStore(NewMemoryBackend())
+	cookie := save(t, s, nil)
+
+	other := newStore(NewMemoryBackend())
+	other.Codecs = NewStore(nil, []byte("another key")).Codecs
+	session, err := other.New(request(cookie), cookieName)
+	require.NoError(t, err)
+	assert.True(t, session.IsNew)
+}
+
+func TestStore_Delete(t *testing.T) {
+	backend := NewMemoryBackend()
+	s := newStore(backend)
+	cookie := save(t, s, map[interface{}]interface{}{OwnerKey: "CN=bob"})
+
+	r := request(cookie)
+	session, err := s.New(r, cookieName)
+	require.NoError(t, err)
+	session.Options.MaxAge = -1
+
+	w := httptest.NewRecorder()
+	require.NoError(t, s.Save(r, w, session))
+	assert.True(t, w.Result().Cookies()[0].MaxAge < 0)
+
+	list, err := backend.List(context.Background(), "CN=bob")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestMemoryBackend_Purge(t *testing.T) {
+	backend := NewMemoryBackend()
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, backend.Save(ctx, &Record{ID: "old", Owner: "CN=a", Created: now, Expires: now.Add(-time.Second)}))
+	require.NoError(t, backend.Save(ctx, &Record{ID: "new", Owner: "CN=a", Created: now, Expires: now.Add(time.Hour)}))
+
+	// created is kept from the first save
+	require.NoError(t, backend.Save(ctx, &Record{ID: "new", Owner: "CN=a", Created: now.Add(time.Minute), Expires: now.Add(time.Hour)}))
+	rec, err := backend.Load(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, now, rec.Created)
+
+	_, err = backend.Load(ctx, "old")
+	assert.Equal(t, ErrNotFound, err)
+
+	n, err := backend.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
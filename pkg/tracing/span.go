@@ -0,0 +1,266 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SpanKind and StatusCode use the OTLP enum values.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	Name          string                 `json:"name"`
+	Kind          SpanKind               `json:"kind"`
+	TraceID       TraceID                `json:"trace_id"`
+	SpanID        SpanID                 `json:"span_id"`
+	ParentSpanID  SpanID                 `json:"parent_span_id,omitempty"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	StatusCode    StatusCode             `json:"status_code,omitempty"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+type Span struct {
+	tracer *Tracer
+	flags  byte
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Flags: s.flags}
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = msg
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed when err is not nil.
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End records the span. Only the first call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+const (
+	batchSize     = 512
+	queueSize     = 2048
+	flushInterval = 5 * time.Second
+)
+
+// Tracer batches finished spans and hands them to an Exporter. A nil Tracer
+// records nothing.
+type Tracer struct {
+	Service string
+
+	exporter Exporter
+	mu       sync.RWMutex
+	closed   bool
+	queue    chan SpanData
+	flush    chan chan struct{}
+	done     chan struct{}
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	t := &Tracer{
+		Service:  service,
+		exporter: exporter,
+		queue:    make(chan SpanData, queueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span. Its parent is the span in ctx, or else a remote span
+// context added with ContextWithRemote.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: t,
+		flags:  FlagSampled,
+		data: SpanData{
+			Name:   name,
+			Kind:   kind,
+			SpanID: newSpanID(),
+			Start:  time.Now(),
+		},
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentSpanID = parent.data.SpanID
+		span.flags = parent.flags
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		span.data.TraceID = remote.TraceID
+		span.data.ParentSpanID = remote.SpanID
+	} else {
+		span.data.TraceID = newTraceID()
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.queue <- data:
+	default:
+		logrus.WithField("span", data.Name).Warn("trace queue full; dropping span")
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			logrus.WithError(err).WithField("spans", len(batch)).Warn("unable to export spans")
+		}
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				export()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ch := <-t.flush:
+			// drain what was queued before the flush
+			for n := len(t.queue); n > 0; n-- {
+				batch = append(batch, <-t.queue)
+			}
+			export()
+			close(ch)
+		}
+	}
+}
+
+// Flush exports every span ended so far.
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	ch := make(chan struct{})
+	select {
+	case t.flush <- ch:
+		<-ch
+	case <-t.done:
+	}
+}
+
+// Shutdown exports the remaining spans and closes the exporter. Spans ended
+// afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Close()
+}
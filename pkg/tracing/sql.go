@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// WrapDriver records a client span for every query, exec, prepare, begin and
+// ping. Calls made with a context that carries a span are recorded as its
+// children; calls without one, e.g. from background jobs or from libraries
+// that don't pass a context, start a root span of tracer. system names the
+// database, e.g. postgresql.
+func WrapDriver(d driver.Driver, tracer *Tracer, system string) driver.Driver {
+	return tracedDriver{d, tracer, system}
+}
+
+type tracedDriver struct {
+	driver.Driver
+	tracer *Tracer
+	system string
+}
+
+func (d tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return tracedConn{conn, d.tracer, d.system}, nil
+}
+
+type tracedConn struct {
+	driver.Conn
+	tracer *Tracer
+	system string
+}
+
+func (c tracedConn) start(ctx context.Context, op, query string) (context.Context, *Span) {
+	ctx, span := c.tracer.Start(ctx, "sql."+op, KindClient)
+	span.SetAttribute("db.system", c.system)
+	if query != "" {
+		span.SetAttribute("db.statement", query)
+	}
+	return ctx, span
+}
+
+func (c tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	ctx, span := c.start(ctx, "prepare", query)
+	defer span.End()
+
+	var stmt driver.Stmt
+	var err error
+	if cp, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = cp.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	span.SetError(err)
+	return stmt, err
+}
+
+func (c tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	ctx, span := c.start(ctx, "begin", "")
+	defer span.End()
+
+	var tx driver.Tx
+	var err error
+	if cb, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = cb.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	span.SetError(err)
+	return tx, err
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.start(ctx, "query", query)
+	defer span.End()
+
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		span.SetError(err)
+	}
+	return rows, err
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.start(ctx, "exec", query)
+	defer span.End()
+
+	result, err := e.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		span.SetError(err)
+	}
+	return result, err
+}
+
+func (c tracedConn) Ping(ctx context.Context) error {
+	p, ok := c.Conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+
+	ctx, span := c.start(ctx, "ping", "")
+	defer span.End()
+
+	err := p.Ping(ctx)
+	span.SetError(err)
+	return err
+}
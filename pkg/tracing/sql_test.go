@@ -0,0 +1,75 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/tracing"
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct {
+	driver.Conn
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func TestWrapDriver(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("test", NewWriterExporter(nopCloser{&buf}))
+	sql.Register("fake+tracing", WrapDriver(fakeDriver{}, tracer, "fake"))
+
+	db, err := sql.Open("fake+tracing", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx, parent := tracer.Start(context.Background(), "GET /", KindServer)
+	_, err = db.ExecContext(ctx, "UPDATE parented")
+	require.NoError(t, err)
+	parent.End()
+
+	// calls without a context, e.g. from libraries, start a root span
+	_, err = db.Exec("UPDATE orphan")
+	require.NoError(t, err)
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	dec := json.NewDecoder(&buf)
+	var spans []map[string]interface{}
+	for dec.More() {
+		var span map[string]interface{}
+		require.NoError(t, dec.Decode(&span))
+		spans = append(spans, span)
+	}
+	require.Len(t, spans, 3)
+
+	assert.Equal(t, "sql.exec", spans[0]["name"])
+	assert.Equal(t, "UPDATE parented", spans[0]["attributes"].(map[string]interface{})["db.statement"])
+	assert.Equal(t, parent.Context().SpanID.String(), spans[0]["parent_span_id"])
+	assert.Equal(t, parent.Context().TraceID.String(), spans[0]["trace_id"])
+
+	assert.Equal(t, "GET /", spans[1]["name"])
+
+	assert.Equal(t, "sql.exec", spans[2]["name"])
+	assert.Equal(t, "UPDATE orphan", spans[2]["attributes"].(map[string]interface{})["db.statement"])
+	assert.Empty(t, spans[2]["parent_span_id"])
+	assert.NotEqual(t, parent.Context().TraceID.String(), spans[2]["trace_id"])
+}
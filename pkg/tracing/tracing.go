@@ -0,0 +1,161 @@
+// Package tracing records spans compatible with OpenTelemetry and
+// propagates them with the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const TraceparentHeader = "traceparent"
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) MarshalText() ([]byte, error) {
+	if !s.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(s.String()), nil
+}
+
+func newTraceID() (rv TraceID) {
+	for !rv.IsValid() {
+		_, _ = rand.Read(rv[:])
+	}
+	return rv
+}
+
+func newSpanID() (rv SpanID) {
+	for !rv.IsValid() {
+		_, _ = rand.Read(rv[:])
+	}
+	return rv
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+}
+
+const FlagSampled byte = 0x01
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header. Versions other than 00 are
+// accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var rv SpanContext
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return rv, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	version, err := decodeHex(parts[0], 1)
+	switch {
+	case err != nil:
+		return rv, errors.Wrapf(err, "invalid traceparent version %q", parts[0])
+	case version[0] == 0xff:
+		return rv, errors.New("invalid traceparent version ff")
+	case version[0] == 0 && len(parts) != 4:
+		return rv, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	traceID, err := decodeHex(parts[1], len(rv.TraceID))
+	if err != nil {
+		return rv, errors.Wrapf(err, "invalid trace id %q", parts[1])
+	}
+	spanID, err := decodeHex(parts[2], len(rv.SpanID))
+	if err != nil {
+		return rv, errors.Wrapf(err, "invalid parent id %q", parts[2])
+	}
+	flags, err := decodeHex(parts[3], 1)
+	if err != nil {
+		return rv, errors.Wrapf(err, "invalid trace flags %q", parts[3])
+	}
+
+	copy(rv.TraceID[:], traceID)
+	copy(rv.SpanID[:], spanID)
+	rv.Flags = flags[0]
+	if !rv.IsValid() {
+		return rv, errors.Errorf("invalid traceparent %q", s)
+	}
+	return rv, nil
+}
+
+// decodeHex only accepts lowercase hex, as required by the spec.
+func decodeHex(s string, n int) ([]byte, error) {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return nil, errors.Errorf("expected %d lowercase hex digits", n*2)
+	}
+	return hex.DecodeString(s)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// ContextWithRemote makes a span context from another process the parent of
+// spans started from ctx.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// FromContext returns the current span, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Start starts a child of the span in ctx using the same tracer. When ctx
+// has no span, nothing is recorded and the returned span is nil; every Span
+// method is safe to call on nil.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
@@ -0,0 +1,160 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/demosdemon/super-potato/pkg/tracing"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"empty", "", true},
+		{"extra fields", valid + "-extra", true},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", true},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", true},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", true},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.header)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, FlagSampled, sc.Flags)
+			if tt.header == valid {
+				assert.Equal(t, valid, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("test", NewWriterExporter(nopCloser{&buf}))
+
+	remote, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	ctx, root := tracer.Start(ContextWithRemote(context.Background(), remote), "GET /", KindServer)
+	root.SetAttribute("http.status_code", 200)
+	_, child := Start(ctx, "child", KindInternal)
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+	root.End()
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	dec := json.NewDecoder(&buf)
+	var spans []map[string]interface{}
+	for dec.More() {
+		var span map[string]interface{}
+		require.NoError(t, dec.Decode(&span))
+		spans = append(spans, span)
+	}
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "child", spans[0]["name"])
+	assert.Equal(t, root.Context().SpanID.String(), spans[0]["parent_span_id"])
+	assert.Equal(t, float64(StatusError), spans[0]["status_code"])
+	assert.Equal(t, "boom", spans[0]["status_message"])
+
+	assert.Equal(t, "GET /", spans[1]["name"])
+	assert.Equal(t, remote.TraceID.String(), spans[1]["trace_id"])
+	assert.Equal(t, remote.SpanID.String(), spans[1]["parent_span_id"])
+	assert.Equal(t, map[string]interface{}{"http.status_code": 200.0}, spans[1]["attributes"])
+
+	// ended after shutdown
+	_, late := tracer.Start(context.Background(), "late", KindInternal)
+	late.End()
+}
+
+func TestStart_NoParent(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(ctx, "orphan", KindInternal)
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, got)
+
+	// a nil span is a no-op
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("ignored"))
+	span.End()
+	assert.False(t, span.Context().IsValid())
+
+	var tracer *Tracer
+	_, span = tracer.Start(ctx, "disabled", KindServer)
+	assert.Nil(t, span)
+	assert.NoError(t, tracer.Shutdown(ctx))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		data, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(data, &body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer("test", NewOTLPExporter(srv.URL+"/v1/traces", "test-service"))
+	_, span := tracer.Start(context.Background(), "span", KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.End()
+	tracer.Flush()
+
+	resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	attrs := resource["resource"].(map[string]interface{})["attributes"]
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"key":   "service.name",
+		"value": map[string]interface{}{"stringValue": "test-service"},
+	}}, attrs)
+
+	scope := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	got := scope["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "span", got["name"])
+	assert.Equal(t, float64(KindClient), got["kind"])
+	assert.Equal(t, span.Context().TraceID.String(), got["traceId"])
+	assert.NotContains(t, got, "parentSpanId")
+	assert.IsType(t, "", got["startTimeUnixNano"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, NewOTLPExporter(failing.URL, "test").Export([]SpanData{{Name: "x"}}))
+}